@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethanzhrepo/dir2prompt/pkg/processor"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	applyDir   string
+	applyYes   bool
+	applyCheck bool
+)
+
+// applyCmd applies file edits proposed in a model response
+var applyCmd = &cobra.Command{
+	Use:   "apply <response>",
+	Short: "Apply file edits proposed in a model response",
+	Long: `apply extracts file edits from a model response and applies them to the
+working tree below --dir. Three kinds of edits are recognized:
+
+  - full-file replacements in the dir2prompt text format ("---" headers or a boundary)
+  - fenced code blocks annotated with a path, e.g. ` + "```go path=main.go" + `, ` + "```go:main.go" + `,
+    a first line such as "// file: main.go", or a line like **main.go** before the block
+  - unified diffs, fenced or not
+
+The resulting changes are shown as a colored diff and written after confirmation,
+or right away with --yes. Nothing is written if any edit does not apply cleanly.
+Paths that are absolute or leave --dir, also through symbolic links, are refused.
+
+  dir2prompt apply response.md
+  dir2prompt apply response.md --check
+  pbpaste | dir2prompt apply - --yes`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
+		edits, err := processor.ParseEdits(string(data))
+		if err != nil {
+			return err
+		}
+		changes, err := processor.PlanEdits(edits, applyDir)
+		if err != nil {
+			return err
+		}
+
+		failed, pending := 0, 0
+		color := useColor(os.Stdout)
+		for _, c := range changes {
+			switch {
+			case c.Err != nil:
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: does not apply: %v\n", c.Path, c.Err)
+			case c.Changed():
+				pending++
+				if applyCheck {
+					fmt.Fprintf(os.Stderr, "%s: applies cleanly\n", c.Path)
+				} else {
+					fmt.Fprint(os.Stdout, c.Diff(color))
+				}
+			default:
+				fmt.Fprintf(os.Stderr, "%s: already up to date\n", c.Path)
+			}
+		}
+
+		if failed > 0 {
+			if applyCheck {
+				return fmt.Errorf("%d of %d files do not apply cleanly", failed, len(changes))
+			}
+			return fmt.Errorf("%d of %d files do not apply cleanly, nothing was written", failed, len(changes))
+		}
+		if applyCheck || pending == 0 {
+			if pending == 0 {
+				fmt.Fprintln(os.Stderr, "No changes to apply.")
+			}
+			return nil
+		}
+
+		if !applyYes {
+			confirmed, err := confirm(fmt.Sprintf("Apply changes to %d files?", pending), args[0] == "-")
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				fmt.Fprintln(os.Stderr, "Aborted, nothing was written.")
+				return nil
+			}
+		}
+
+		return processor.WriteChanges(changes, os.Stderr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVarP(&applyDir, "dir", "d", ".", "Root directory the edited paths are relative to; nothing outside it is written")
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Write the changes without asking for confirmation")
+	applyCmd.Flags().BoolVar(&applyCheck, "check", false, "Only check that all edits apply cleanly, exiting non-zero if not")
+}
+
+// confirm asks a yes/no question on the terminal. It fails when stdin is not a
+// terminal or carries the input, since there is nobody to answer.
+func confirm(question string, stdinUsed bool) (bool, error) {
+	if stdinUsed || !isTerminal(os.Stdin) {
+		return false, fmt.Errorf("confirmation required: run in a terminal or pass --yes")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read answer: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// useColor reports whether output to the file should be colored. NO_COLOR disables colors.
+func useColor(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(f)
+}
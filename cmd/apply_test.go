@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupApplyTest creates a working tree with main.go and a response editing it
+func setupApplyTest(t *testing.T, response string) (string, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nvar x = 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	responseFile := filepath.Join(t.TempDir(), "response.md")
+	if err := os.WriteFile(responseFile, []byte(response), 0644); err != nil {
+		t.Fatalf("Failed to write response: %v", err)
+	}
+	return root, responseFile
+}
+
+const applyResponse = "Bump x:\n\n```diff\n--- a/main.go\n+++ b/main.go\n@@ -3 +3 @@\n-var x = 1\n+var x = 2\n```\n"
+
+// TestApplyCommand tests writing edits with --yes
+func TestApplyCommand(t *testing.T) {
+	root, response := setupApplyTest(t, applyResponse)
+
+	stdout, stderr, err := executeCommand(t, "apply", response, "-d", root, "--yes")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout, "-var x = 1\n+var x = 2\n") {
+		t.Errorf("Expected diff on stdout, got:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "Updated main.go") {
+		t.Errorf("Expected update message, got: %s", stderr)
+	}
+	content, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if string(content) != "package main\n\nvar x = 2\n" {
+		t.Errorf("main.go = %q", content)
+	}
+}
+
+// TestApplyCommandCheck tests that --check reports without writing
+func TestApplyCommandCheck(t *testing.T) {
+	root, response := setupApplyTest(t, applyResponse)
+	if _, _, err := executeCommand(t, "apply", response, "-d", root, "--check"); err != nil {
+		t.Errorf("Expected clean check, got: %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if string(content) != "package main\n\nvar x = 1\n" {
+		t.Errorf("--check modified main.go: %q", content)
+	}
+
+	conflicting := strings.ReplaceAll(applyResponse, "-var x = 1", "-var x = 3")
+	root, response = setupApplyTest(t, conflicting)
+	_, stderr, err := executeCommand(t, "apply", response, "-d", root, "--check")
+	if err == nil {
+		t.Error("Expected error for a patch that does not apply")
+	}
+	if !strings.Contains(stderr, "main.go: does not apply") {
+		t.Errorf("Expected failure message, got: %s", stderr)
+	}
+}
+
+// TestApplyCommandRequiresConfirmation tests that nothing is written without a terminal or --yes
+func TestApplyCommandRequiresConfirmation(t *testing.T) {
+	root, response := setupApplyTest(t, applyResponse)
+	if _, _, err := executeCommand(t, "apply", response, "-d", root); err == nil {
+		t.Error("Expected error without confirmation")
+	}
+	content, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if string(content) != "package main\n\nvar x = 1\n" {
+		t.Errorf("main.go was modified without confirmation: %q", content)
+	}
+}
+
+// TestApplyCommandOutsideRoot tests that edits outside the root are refused
+func TestApplyCommandOutsideRoot(t *testing.T) {
+	root, response := setupApplyTest(t, "```go path=../escape.go\npackage escape\n```\n")
+	if _, _, err := executeCommand(t, "apply", response, "-d", root, "--yes"); err == nil {
+		t.Error("Expected error for a path outside the root")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape.go")); !os.IsNotExist(err) {
+		t.Error("File was written outside the root")
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethanzhrepo/dir2prompt/pkg/config"
+	"github.com/ethanzhrepo/dir2prompt/pkg/processor"
+	"github.com/spf13/cobra"
+)
+
+var clearCacheDir string
+
+// cacheCmd groups the commands managing the cache of file metadata and token counts
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of file metadata and token counts",
+	Long: `dir2prompt caches whether files are text, their line counts and token counts
+between runs, so repeated runs over unchanged files skip detecting and tokenizing
+them. The cache lives in dir2prompt below the user cache directory unless
+--cache-dir is given, and is bypassed with --no-cache.`,
+}
+
+// cacheClearCmd removes the cache
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached file metadata and token counts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := resolveCacheDir(clearCacheDir)
+		if err != nil {
+			return err
+		}
+
+		if err := processor.ClearCache(dir); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Cleared cache %s\n", dir)
+		return nil
+	},
+}
+
+// resolveCacheDir returns the cache directory of a subcommand: the given one, the one
+// of the DIR2PROMPT_CACHE_DIR environment variable or the default one
+func resolveCacheDir(dir string) (string, error) {
+	if dir == "" {
+		dir = os.Getenv(config.EnvName("cache-dir"))
+	}
+	if dir == "" {
+		return processor.DefaultCacheDir()
+	}
+	return dir, nil
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheClearCmd.Flags().StringVar(&clearCacheDir, "cache-dir", "", "Directory of the cache to clear (defaults to dir2prompt in the user cache directory)")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCacheFlags tests that runs fill the cache unless --no-cache is given and that
+// cache clear removes it
+func TestCacheFlags(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+
+	if _, _, err := executeCommand(t, tempDir, "--no-cache", "--cache-dir", cacheDir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("Expected no cache with --no-cache, got %v", err)
+	}
+
+	if _, _, err := executeCommand(t, tempDir, "--cache-dir", cacheDir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entries, err := os.ReadDir(cacheDir); err != nil || len(entries) == 0 {
+		t.Fatalf("Expected a cache file, got %v, %v", entries, err)
+	}
+
+	_, stderr, err := executeCommand(t, "cache", "clear", "--cache-dir", cacheDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stderr, "Cleared cache") {
+		t.Errorf("Expected a confirmation, got %q", stderr)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the cache to be removed, got %v", err)
+	}
+}
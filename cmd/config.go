@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethanzhrepo/dir2prompt/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options that only make sense on the command line or in the environment
+var configOnlyFlags = map[string]bool{
+	"help":    true,
+	"config":  true,
+	"profile": true,
+	"dir":     true,
+}
+
+// applyConfig fills in every flag that was not given on the command line, first
+// from DIR2PROMPT_* environment variables and then from the selected profile of
+// the nearest .dir2prompt.yaml. Command line flags therefore take precedence over
+// the environment, which takes precedence over the config file.
+func applyConfig(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+
+	// Environment layer
+	var envErr error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if envErr != nil || f.Changed || f.Name == "help" {
+			return
+		}
+		if value, ok := os.LookupEnv(config.EnvName(f.Name)); ok {
+			if err := flags.Set(f.Name, value); err != nil {
+				envErr = fmt.Errorf("invalid value for %s: %w", config.EnvName(f.Name), err)
+			}
+		}
+	})
+	if envErr != nil {
+		return envErr
+	}
+
+	// Config file layer
+	path := configFile
+	if path == "" {
+		startDir := dirPath
+		if startDir == "" {
+			startDir = "."
+		}
+		found, err := config.Find(startDir)
+		if err != nil {
+			return err
+		}
+		path = found
+	}
+
+	if path == "" {
+		if profile != "" {
+			return fmt.Errorf("profile '%s' requested but no %s file was found", profile, config.FileName)
+		}
+		return nil
+	}
+
+	file, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	values, err := file.Values(profile)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		f := flags.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("unknown option '%s' in %s", name, path)
+		}
+		if configOnlyFlags[name] {
+			return fmt.Errorf("option '%s' cannot be set in %s", name, path)
+		}
+		if f.Changed {
+			continue
+		}
+
+		// Repeatable flags take one list item per occurrence; the others take a
+		// comma-separated list, like on the command line
+		items := value
+		if t := f.Value.Type(); t != "stringArray" && t != "stringSlice" {
+			items = []string{strings.Join(value, ",")}
+		}
+		for _, item := range items {
+			if err := flags.Set(name, item); err != nil {
+				return fmt.Errorf("invalid value for '%s' in %s: %w", name, path, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestConfigProfiles tests the precedence of command line flags, environment variables and config file profiles
+func TestConfigProfiles(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	configContent := `exclude-files: ["*.bin", "*.tmp"]
+profiles:
+  docs:
+    include-files: ["*.md"]
+  code:
+    include-files: ["*.go"]
+`
+	if err := os.WriteFile(filepath.Join(tempDir, ".dir2prompt.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	// The config file is discovered from a subdirectory as well
+	srcDir := filepath.Join(tempDir, "src")
+
+	tests := []struct {
+		name          string
+		args          []string
+		env           map[string]string
+		expectedFiles []string
+		excludedFiles []string
+		expectedError bool
+	}{
+		{
+			name:          "defaults only",
+			args:          []string{tempDir},
+			expectedFiles: []string{"README.md", "main.go", "src/lib.go", "docs/guide.md"},
+			excludedFiles: []string{"binary.bin", "docs/draft.tmp"},
+		},
+		{
+			name:          "docs profile",
+			args:          []string{tempDir, "--profile", "docs"},
+			expectedFiles: []string{"README.md", "docs/guide.md"},
+			excludedFiles: []string{"main.go", "src/lib.go"},
+		},
+		{
+			name:          "profile from environment",
+			args:          []string{tempDir},
+			env:           map[string]string{"DIR2PROMPT_PROFILE": "code"},
+			expectedFiles: []string{"main.go", "src/lib.go"},
+			excludedFiles: []string{"README.md"},
+		},
+		{
+			name:          "environment overrides profile",
+			args:          []string{tempDir, "--profile", "code"},
+			env:           map[string]string{"DIR2PROMPT_INCLUDE_FILES": "*.md"},
+			expectedFiles: []string{"README.md"},
+			excludedFiles: []string{"main.go"},
+		},
+		{
+			name:          "flag overrides environment",
+			args:          []string{tempDir, "--include-files", "src/*"},
+			env:           map[string]string{"DIR2PROMPT_INCLUDE_FILES": "*.md"},
+			expectedFiles: []string{"src/lib.go"},
+			excludedFiles: []string{"README.md", "main.go"},
+		},
+		{
+			name:          "discovered from subdirectory",
+			args:          []string{srcDir, "--profile", "code"},
+			expectedFiles: []string{"lib.go"},
+		},
+		{
+			name:          "unknown profile",
+			args:          []string{tempDir, "--profile", "missing"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			stdout, _, err := executeCommand(t, tc.args...)
+			if tc.expectedError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, file := range tc.expectedFiles {
+				if !strings.Contains(stdout, "File: "+file) {
+					t.Errorf("Expected output to contain %s", file)
+				}
+			}
+			for _, file := range tc.excludedFiles {
+				if strings.Contains(stdout, "File: "+file) {
+					t.Errorf("Output should not contain %s", file)
+				}
+			}
+		})
+	}
+}
+
+// TestConfigUnknownOption tests that typos in the config file are reported
+func TestConfigUnknownOption(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	if err := os.WriteFile(filepath.Join(tempDir, ".dir2prompt.yaml"), []byte("include-file: \"*.go\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	_, _, err := executeCommand(t, tempDir)
+	if err == nil || !strings.Contains(err.Error(), "unknown option 'include-file'") {
+		t.Errorf("Expected unknown option error, got: %v", err)
+	}
+}
+
+// TestConfigRepeatableFlags tests that config file lists map onto repeatable flags item by item
+func TestConfigRepeatableFlags(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	configContent := "include-regex: ['^src/', 'a{1,2}in\\.go$']\nexclude-files: [\"*.bin\"]\n"
+	if err := os.WriteFile(filepath.Join(tempDir, ".dir2prompt.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	stdout, _, err := executeCommand(t, tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, file := range []string{"src/lib.go", "main.go"} {
+		if !strings.Contains(stdout, "File: "+file) {
+			t.Errorf("Expected output to contain %s", file)
+		}
+	}
+	for _, file := range []string{"README.md", "docs/guide.md"} {
+		if strings.Contains(stdout, "File: "+file) {
+			t.Errorf("Output should not contain %s", file)
+		}
+	}
+}
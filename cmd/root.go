@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ethanzhrepo/dir2prompt/pkg/processor"
 	"github.com/spf13/cobra"
@@ -14,6 +18,44 @@ var (
 	includeFiles string
 	excludeFiles string
 	output       string
+	noGitignore  bool
+	configFile   string
+	profile      string
+	presets      string
+	excludeTests bool
+	gitDiffRef   string
+	gitStaged    bool
+	gitUnstaged  bool
+	includeDiff  bool
+	rev          string
+	globMode     string
+	includeRegex []string
+	excludeRegex []string
+	contains     []string
+	notContains  []string
+	maxTokens    int
+	priorities   []string
+	rankBy       string
+	chunkTokens  int
+	format       string
+	templateFile string
+	boundary     string
+	tokenizer    string
+	model        string
+	tokenizerDir string
+	report       bool
+	reportFormat string
+	treeAnnotate string
+	treeScope    string
+	treeExclude  string
+	treeDepth    int
+	treeChildren int
+	noTree       bool
+	jobs         int
+	noCache      bool
+	cacheDir     string
+	watch        bool
+	debounce     time.Duration
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -28,13 +70,37 @@ context for large language models (LLMs) or for code analysis.
 
 The tool automatically ignores all hidden directories and files (starting with '.'),
 including .git directories and git-related files such as .gitignore.
+Files ignored by git (.gitignore, .git/info/exclude and core.excludesFile) are
+skipped as well unless --no-gitignore is given. A .dir2promptignore or
+.dir2promptinclude file in any scanned directory further narrows the selection
+using gitignore syntax.
 
 Directory path can be specified as a positional argument or with the --dir flag.
-You can use '.' to represent the current directory, e.g., 'dir2prompt . -o output.txt'`,
+You can use '.' to represent the current directory, e.g., 'dir2prompt . -o output.txt'
+
+Flags that are not given on the command line are read from DIR2PROMPT_* environment
+variables (e.g. DIR2PROMPT_EXCLUDE_FILES) and then from the nearest .dir2prompt.yaml
+found in the scanned directory or its parents. The file uses flag names as keys and
+can define named profiles selected with --profile:
+
+  exclude-files: ["*.tmp"]
+  profiles:
+    backend:
+      include-files: ["cmd/**", "pkg/**"]
+    docs:
+      include-files: ["*.md", "docs/**"]`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// 检查是否有位置参数作为目录路径
 		if len(args) > 0 && dirPath == "" {
-			dirPath = args[0]
+			if err := cmd.Flags().Set("dir", args[0]); err != nil {
+				return err
+			}
+		}
+
+		// Fill in unset flags from the environment and .dir2prompt.yaml
+		if err := applyConfig(cmd); err != nil {
+			return err
 		}
 
 		// Validate required flags
@@ -47,7 +113,8 @@ You can use '.' to represent the current directory, e.g., 'dir2prompt . -o outpu
 
 		// Split comma-separated patterns into slices
 		var includePatterns []string
-		if includeFiles == "" {
+		presetNames := splitPatterns(presets)
+		if includeFiles == "" && len(presetNames) == 0 && len(includeRegex) == 0 {
 			// If no include pattern is specified, include all files by default
 			includePatterns = []string{"*"}
 		} else {
@@ -55,13 +122,60 @@ You can use '.' to represent the current directory, e.g., 'dir2prompt . -o outpu
 		}
 		excludePatterns := splitPatterns(excludeFiles)
 
+		// The report replaces the token estimate with a breakdown per file
+		var reportAs string
+		if report {
+			reportAs = reportFormat
+		}
+
+		// Cache metadata and token counts unless disabled or no cache directory exists
+		cache := ""
+		if !noCache {
+			cache = cacheDir
+			if cache == "" {
+				cache, _ = processor.DefaultCacheDir()
+			}
+		}
+
 		// Create processor configuration
 		config := processor.Config{
-			DirPath:        dirPath,
-			IncludeFiles:   includePatterns,
-			ExcludeFiles:   excludePatterns,
-			Output:         output,
-			EstimateTokens: true,
+			DirPath:         dirPath,
+			IncludeFiles:    includePatterns,
+			ExcludeFiles:    excludePatterns,
+			Output:          output,
+			EstimateTokens:  true,
+			NoGitignore:     noGitignore,
+			Presets:         presetNames,
+			ExcludeTests:    excludeTests,
+			GitDiffRef:      gitDiffRef,
+			GitStaged:       gitStaged,
+			GitUnstaged:     gitUnstaged,
+			IncludeDiff:     includeDiff,
+			Rev:             rev,
+			GlobMode:        globMode,
+			IncludeRegex:    includeRegex,
+			ExcludeRegex:    excludeRegex,
+			Contains:        contains,
+			NotContains:     notContains,
+			MaxTokens:       maxTokens,
+			Priorities:      priorities,
+			RankBy:          splitPatterns(rankBy),
+			ChunkTokens:     chunkTokens,
+			Format:          format,
+			Template:        templateFile,
+			Boundary:        boundary,
+			Tokenizer:       tokenizer,
+			Model:           model,
+			TokenizerData:   tokenizerDir,
+			Report:          reportAs,
+			TreeAnnotate:    splitPatterns(treeAnnotate),
+			TreeScope:       treeScope,
+			TreeExclude:     splitPatterns(treeExclude),
+			TreeMaxDepth:    treeDepth,
+			TreeMaxChildren: treeChildren,
+			NoTree:          noTree,
+			Jobs:            jobs,
+			CacheDir:        cache,
 		}
 
 		// Create and run the processor
@@ -70,6 +184,13 @@ You can use '.' to represent the current directory, e.g., 'dir2prompt . -o outpu
 			return err
 		}
 
+		// Keep the output file up to date until interrupted
+		if watch {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return proc.Watch(ctx, debounce)
+		}
+
 		return proc.Process()
 	},
 }
@@ -84,11 +205,70 @@ func Execute() {
 }
 
 func init() {
-	// Define flags
+	// Define flags, listed in groups in the help output
+	rootCmd.Flags().SortFlags = false
 	rootCmd.Flags().StringVar(&dirPath, "dir", "", "Root directory path to scan (can also be specified as positional argument, use '.' for current directory)")
 	rootCmd.Flags().StringVar(&includeFiles, "include-files", "", "Comma-separated list of glob patterns to include files (defaults to all files if not specified)")
 	rootCmd.Flags().StringVar(&excludeFiles, "exclude-files", "", "Comma-separated list of glob patterns to exclude files")
 	rootCmd.Flags().StringVarP(&output, "output", "o", "-", "Output destination (file path or '-' for stdout)")
+
+	// File selection
+	rootCmd.Flags().StringVar(&globMode, "glob-mode", processor.GlobModeDoublestar, "Pattern semantics: 'doublestar' ('*' stops at '/', '**' spans directories) or 'legacy' ('*' also matches '/')")
+	rootCmd.Flags().StringArrayVar(&includeRegex, "include-regex", nil, "Regular expression of relative paths to include (repeatable)")
+	rootCmd.Flags().StringArrayVar(&excludeRegex, "exclude-regex", nil, "Regular expression of relative paths to exclude (repeatable)")
+	rootCmd.Flags().StringArrayVar(&contains, "contains", nil, "Only include files whose content matches this regular expression (repeatable, any must match)")
+	rootCmd.Flags().StringArrayVar(&notContains, "not-contains", nil, "Exclude files whose content matches this regular expression (repeatable)")
+	rootCmd.Flags().BoolVar(&noGitignore, "no-gitignore", false, "Do not skip files ignored by .gitignore, .git/info/exclude or core.excludesFile")
+	rootCmd.Flags().StringVar(&presets, "preset", "", "Comma-separated list of ecosystem presets ("+strings.Join(processor.PresetNames(), ", ")+") or 'auto' to detect them")
+	rootCmd.Flags().BoolVar(&excludeTests, "exclude-tests", false, "Also exclude test files defined by the selected presets")
+
+	// Git
+	rootCmd.Flags().StringVar(&gitDiffRef, "git-diff", "", "Only include files changed since the given git ref (commit, branch or tag)")
+	rootCmd.Flags().BoolVar(&gitStaged, "staged", false, "Only include files with staged changes")
+	rootCmd.Flags().BoolVar(&gitUnstaged, "unstaged", false, "Only include files with unstaged changes and untracked files")
+	rootCmd.Flags().BoolVar(&includeDiff, "include-diff", false, "Append the unified diff after the file contents (with --git-diff, --staged or --unstaged)")
+	rootCmd.Flags().StringVar(&rev, "rev", "", "Read files from a git commit, tag or branch instead of the working tree")
+
+	// Config file
+	rootCmd.Flags().StringVar(&configFile, "config", "", "Path to a config file (defaults to the nearest .dir2prompt.yaml)")
+	rootCmd.Flags().StringVar(&profile, "profile", "", "Name of the config file profile to apply")
+
+	// Token budget and chunks
+	rootCmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Token budget of the output; lower ranked files are reduced to an outline or their path (0 for no limit)")
+	rootCmd.Flags().StringArrayVar(&priorities, "priority", nil, "Priority rule 'pattern=weight' used to rank files under --max-tokens (repeatable, higher weights first)")
+	rootCmd.Flags().StringVar(&rankBy, "rank-by", "", "Comma-separated tie-breakers for files of equal priority: recency, size, depth (default depth,size)")
+	rootCmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files (output.001.txt, ...) of at most this many tokens; requires --output")
+
+	// Output format
+	rootCmd.Flags().StringVar(&format, "format", processor.FormatText, "Output format: "+strings.Join(processor.FormatNames(), ", "))
+	rootCmd.Flags().StringVar(&templateFile, "template", "", "Render the output with a Go text/template file instead of --format")
+	rootCmd.Flags().StringVar(&boundary, "boundary", processor.BoundaryAuto, "Text format delimiters: auto (boundary only when a file contains header-like text), hash, random or none")
+
+	// Token estimation
+	rootCmd.Flags().StringVar(&tokenizer, "tokenizer", "", "Tokenizer estimating tokens: "+strings.Join(processor.TokenizerNames(), ", ")+" (default cl100k_base)")
+	rootCmd.Flags().StringVar(&model, "model", "", "Estimate tokens with the encoding of this OpenAI model (e.g. gpt-4o) instead of --tokenizer")
+	rootCmd.Flags().StringVar(&tokenizerDir, "tokenizer-data", "", "Directory with .tiktoken files (e.g. cl100k_base.tiktoken) to load encodings offline")
+
+	// Report
+	rootCmd.Flags().BoolVar(&report, "report", false, "Print the tokens, lines and bytes of every file and directory to stderr, most expensive first")
+	rootCmd.Flags().StringVar(&reportFormat, "report-format", processor.ReportTable, "Format of --report: table or json")
+
+	// Directory tree
+	rootCmd.Flags().StringVar(&treeAnnotate, "tree-annotate", "", "Comma-separated metrics shown next to every file and directory in the tree: size, lines, tokens")
+	rootCmd.Flags().StringVar(&treeScope, "tree-scope", processor.TreeScopeMatched, "Files shown in the directory tree: matched, or all files that are not ignored with the included ones marked")
+	rootCmd.Flags().StringVar(&treeExclude, "tree-exclude", "", "Comma-separated list of glob patterns to hide files from the directory tree")
+	rootCmd.Flags().IntVar(&treeDepth, "tree-max-depth", 0, "Deepest level of the directory tree to list; deeper directories are summarized (0 for no limit)")
+	rootCmd.Flags().IntVar(&treeChildren, "tree-max-children", 0, "Entries listed per directory in the tree before the rest is summarized (0 for no limit)")
+	rootCmd.Flags().BoolVar(&noTree, "no-tree", false, "Omit the directory structure from the output")
+
+	// Performance
+	rootCmd.Flags().IntVar(&jobs, "jobs", 0, "Number of files checked and read concurrently (0 for the number of CPUs)")
+	rootCmd.Flags().BoolVar(&noCache, "no-cache", false, "Do not read or update the cache of file metadata and token counts")
+	rootCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Directory of the cache of file metadata and token counts (defaults to dir2prompt in the user cache directory)")
+
+	// Watch mode
+	rootCmd.Flags().BoolVar(&watch, "watch", false, "Keep running and rewrite the output file whenever an included file changes or a new matching file appears")
+	rootCmd.Flags().DurationVar(&debounce, "watch-debounce", processor.DefaultWatchDebounce, "How long --watch waits for a burst of changes to end before rewriting the output")
 	// 不再将dir标记为必需，因为可以从位置参数提供
 	// rootCmd.MarkFlagRequired("dir")
 }
@@ -2,13 +2,32 @@ package cmd
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/ethanzhrepo/dir2prompt/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// TestMain keeps the cache written by the tests out of the user cache directory
+func TestMain(m *testing.M) {
+	cacheDir, err := os.MkdirTemp("", "dir2prompt-cmd-cache")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create cache directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Setenv(config.EnvName("cache-dir"), cacheDir)
+
+	code := m.Run()
+	os.RemoveAll(cacheDir)
+	os.Exit(code)
+}
+
 // setupTestDir creates a temporary test directory structure for command tests
 func setupTestDir(t *testing.T) string {
 	// Create a temporary directory for tests
@@ -55,6 +74,75 @@ func cleanupTestDir(path string) {
 	os.RemoveAll(path)
 }
 
+// resetCommandFlags restores every flag of the root command and its subcommands to its default value
+func resetCommandFlags() {
+	resetFlags := func(flags *pflag.FlagSet) {
+		flags.VisitAll(func(f *pflag.Flag) {
+			if sv, ok := f.Value.(pflag.SliceValue); ok {
+				sv.Replace(nil)
+			} else {
+				f.Value.Set(f.DefValue)
+			}
+			f.Changed = false
+		})
+	}
+	var resetCommands func(cmd *cobra.Command)
+	resetCommands = func(cmd *cobra.Command) {
+		for _, sub := range cmd.Commands() {
+			resetFlags(sub.Flags())
+			resetCommands(sub)
+		}
+	}
+	resetFlags(rootCmd.Flags())
+	resetFlags(rootCmd.PersistentFlags())
+	resetCommands(rootCmd)
+}
+
+// executeCommand resets every flag to its default, runs the root command with the
+// given arguments and returns the captured stdout and stderr
+func executeCommand(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+
+	origArgs := os.Args
+	defer func() { os.Args = origArgs }()
+	os.Args = append([]string{"dir2prompt"}, args...)
+
+	// Reset before and after so no state leaks into tests that set variables directly
+	resetCommandFlags()
+	t.Cleanup(resetCommandFlags)
+
+	// Capture stdout and stderr
+	oldStdout := os.Stdout
+	oldStderr := os.Stderr
+	stdoutR, stdoutW, _ := os.Pipe()
+	stderrR, stderrW, _ := os.Pipe()
+	os.Stdout = stdoutW
+	os.Stderr = stderrW
+
+	stdoutDone := make(chan string)
+	stderrDone := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, stdoutR)
+		stdoutDone <- buf.String()
+	}()
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, stderrR)
+		stderrDone <- buf.String()
+	}()
+
+	err := rootCmd.Execute()
+
+	// Close writers and restore stdout/stderr
+	stdoutW.Close()
+	stderrW.Close()
+	os.Stdout = oldStdout
+	os.Stderr = oldStderr
+
+	return <-stdoutDone, <-stderrDone, err
+}
+
 // TestRootCommand tests the root command execution
 func TestRootCommand(t *testing.T) {
 	tempDir := setupTestDir(t)
@@ -490,3 +578,149 @@ func TestCurrentDirectory(t *testing.T) {
 
 // Override os.Exit for testing
 var osExit = os.Exit
+
+// TestTokenizerFlags tests selecting the tokenizer used for the estimate
+func TestTokenizerFlags(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	_, stderr, err := executeCommand(t, tempDir, "--include-files", "README.md", "--tokenizer", "words")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stderr, "Estimated tokens:") || strings.Contains(stderr, "Warning") {
+		t.Errorf("Expected a token estimate without warnings, got: %s", stderr)
+	}
+
+	for _, args := range [][]string{
+		{"--tokenizer", "gpt2"},
+		{"--model", "unknown-model"},
+		{"--tokenizer", "chars", "--model", "gpt-4o"},
+	} {
+		if _, _, err := executeCommand(t, append([]string{tempDir}, args...)...); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+// TestReportFlags tests the per-file token report
+func TestReportFlags(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	_, stderr, err := executeCommand(t, tempDir, "--include-files", "*.go", "--tokenizer", "words", "--report")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stderr, "Token report (words):") || !strings.Contains(stderr, "main.go") {
+		t.Errorf("Expected a token report, got: %s", stderr)
+	}
+
+	_, stderr, err = executeCommand(t, tempDir, "--include-files", "*.go", "--tokenizer", "words", "--report", "--report-format", "json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(stderr, "{") || !strings.Contains(stderr, `"tokenizer":"words"`) {
+		t.Errorf("Expected a JSON report, got: %s", stderr)
+	}
+
+	if _, _, err := executeCommand(t, tempDir, "--report", "--report-format", "csv"); err == nil {
+		t.Error("Expected error for an unknown report format")
+	}
+}
+
+// TestTreeAnnotateFlag tests annotating the directory tree
+func TestTreeAnnotateFlag(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	stdout, _, err := executeCommand(t, tempDir, "--include-files", "*.go", "--tree-annotate", "lines,tokens", "--tokenizer", "words")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout, "main.go (5 lines, ") {
+		t.Errorf("Expected annotated tree, got:\n%s", stdout)
+	}
+
+	if _, _, err := executeCommand(t, tempDir, "--tree-annotate", "bytes"); err == nil {
+		t.Error("Expected error for an unknown tree annotation")
+	}
+}
+
+// TestTreeScopeFlags tests showing the whole project in the tree
+func TestTreeScopeFlags(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	stdout, _, err := executeCommand(t, tempDir, "--include-files", "main.go", "--tree-scope", "all", "--tree-exclude", "docs/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout, "main.go [included]") || !strings.Contains(stdout, "── README.md\n") {
+		t.Errorf("Expected the whole project in the tree, got:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "guide.md") || strings.Contains(stdout, "File: README.md") {
+		t.Errorf("Unexpected tree or content:\n%s", stdout)
+	}
+
+	if _, _, err := executeCommand(t, tempDir, "--tree-scope", "some"); err == nil {
+		t.Error("Expected error for an unknown tree scope")
+	}
+}
+
+// TestTreeLimitFlags tests limiting and omitting the directory structure
+func TestTreeLimitFlags(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	stdout, _, err := executeCommand(t, tempDir, "--tree-max-depth", "1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout, "── docs/ (") || strings.Contains(stdout, "── guide.md") {
+		t.Errorf("Expected collapsed directories, got:\n%s", stdout)
+	}
+
+	stdout, _, err = executeCommand(t, tempDir, "--no-tree")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(stdout, "Directory Structure:") || !strings.Contains(stdout, "File: main.go") {
+		t.Errorf("Expected output without a directory structure, got:\n%s", stdout)
+	}
+}
+
+// TestJobsFlag tests that concurrent scanning gives the same output and rejects negative values
+func TestJobsFlag(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	serial, _, err := executeCommand(t, tempDir, "--jobs", "1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	concurrent, _, err := executeCommand(t, tempDir, "--jobs", "4")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if serial != concurrent {
+		t.Errorf("Expected the same output with --jobs 4, got:\n%s\nwant:\n%s", concurrent, serial)
+	}
+
+	if _, _, err := executeCommand(t, tempDir, "--jobs", "-1"); err == nil {
+		t.Error("Expected error for negative --jobs")
+	}
+}
+
+// TestWatchFlag tests that watch mode refuses outputs it cannot keep up to date
+func TestWatchFlag(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	if _, _, err := executeCommand(t, tempDir, "--watch"); err == nil || !strings.Contains(err.Error(), "output file") {
+		t.Errorf("Expected an error for watching without an output file, got %v", err)
+	}
+	if _, _, err := executeCommand(t, tempDir, "--watch", "--watch-debounce", "soon", "-o", filepath.Join(t.TempDir(), "out.txt")); err == nil {
+		t.Error("Expected an error for an invalid debounce")
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ethanzhrepo/dir2prompt/pkg/processor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr          string
+	serveNoCache       bool
+	serveCacheDir      string
+	serveTokenizerData string
+	serveAllowHistory  bool
+)
+
+// serveCmd exposes prompt generation over a local HTTP server
+var serveCmd = &cobra.Command{
+	Use:   "serve [root]",
+	Short: "Serve prompts, trees, files and token statistics over HTTP",
+	Long: `serve starts a local HTTP server so tools and browser extensions can generate
+prompts without running dir2prompt for every request. Everything it exposes is
+restricted to the root directory (default '.'): paths escaping it are rejected, as
+are hidden, gitignored and .dir2promptignore'd paths. Committed files, which
+those rules do not cover, are only exposed with --allow-history.
+
+  POST /bundle        output for a JSON body with the fields of processor.Config,
+                      e.g. {"DirPath": "pkg", "IncludeFiles": ["**/*.go"], "Format": "json"}
+  GET  /tree          directory structure and matched files as JSON
+  GET  /file?path=    content of a text file
+  GET  /stats         per-file and per-directory token report as JSON
+
+/tree and /stats select files with the query parameters dir, include, exclude,
+preset, exclude_tests, glob_mode and tree_scope; /stats also takes tokenizer and
+model. /bundle returns the estimate in the X-Estimated-Tokens header when
+EstimateTokens is true.
+
+  dir2prompt serve . --addr 127.0.0.1:8080
+  curl -d '{"IncludeFiles": ["**/*.go"]}' localhost:8080/bundle`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		}
+
+		cache := ""
+		if !serveNoCache {
+			cache, _ = resolveCacheDir(serveCacheDir)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return processor.Serve(ctx, serveAddr, root, processor.Config{CacheDir: cache, TokenizerData: serveTokenizerData}, serveAllowHistory)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveAddr, "addr", processor.DefaultServeAddr, "Address to listen on; keep it on a loopback address unless every file below the root may be read by others")
+	serveCmd.Flags().BoolVar(&serveNoCache, "no-cache", false, "Do not read or update the cache of file metadata and token counts")
+	serveCmd.Flags().StringVar(&serveCacheDir, "cache-dir", "", "Directory of the cache of file metadata and token counts (defaults to dir2prompt in the user cache directory)")
+	serveCmd.Flags().StringVar(&serveTokenizerData, "tokenizer-data", "", "Directory with .tiktoken files (e.g. cl100k_base.tiktoken) to load encodings offline")
+	serveCmd.Flags().BoolVar(&serveAllowHistory, "allow-history", false, "Let /bundle requests set Rev and IncludeDiff, which read committed files including deleted and now ignored ones")
+}
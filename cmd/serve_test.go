@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestServeCommandErrors tests that the server refuses to start for a missing root or
+// an invalid address
+func TestServeCommandErrors(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"missing root", []string{"serve", filepath.Join(tempDir, "missing")}, "failed to open root"},
+		{"file as root", []string{"serve", filepath.Join(tempDir, "main.go")}, "is not a directory"},
+		{"invalid address", []string{"serve", tempDir, "--addr", "127.0.0.1:notaport"}, "failed to listen"},
+	}
+
+	for _, test := range tests {
+		_, _, err := executeCommand(t, test.args...)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethanzhrepo/dir2prompt/pkg/processor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unpackDir    string
+	unpackDryRun bool
+)
+
+// unpackCmd restores files from dir2prompt output
+var unpackCmd = &cobra.Command{
+	Use:   "unpack <bundle>...",
+	Short: "Restore files from dir2prompt output",
+	Long: `unpack parses dir2prompt output back into a directory tree. Every built-in
+format is recognized (text with "---" headers or a boundary, xml, markdown, json
+and jsonl), so bundles received from colleagues or edited by an LLM can be
+restored. Pass all chunk files of a chunked output to join files that were split
+across chunks, or '-' to read from stdin.
+
+Paths are restored relative to --dir. Absolute paths and paths that escape the
+target directory are rejected before anything is written. Files whose content
+was omitted or reduced to an outline by the token budget are skipped.
+
+  dir2prompt unpack bundle.txt -d outdir
+  dir2prompt unpack prompt.001.txt prompt.002.txt --dry-run`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var bundles [][]byte
+		for _, arg := range args {
+			var data []byte
+			var err error
+			if arg == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(arg)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read bundle: %w", err)
+			}
+			bundles = append(bundles, data)
+		}
+
+		files, err := processor.ParseBundles(bundles...)
+		if err != nil {
+			return fmt.Errorf("failed to parse bundle: %w", err)
+		}
+
+		return processor.Unpack(files, unpackDir, unpackDryRun, os.Stderr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unpackCmd)
+	unpackCmd.Flags().StringVarP(&unpackDir, "dir", "d", ".", "Directory to restore the files into")
+	unpackCmd.Flags().BoolVar(&unpackDryRun, "dry-run", false, "List the files that would be written without writing them")
+}
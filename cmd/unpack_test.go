@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestUnpackCommand tests restoring files with the unpack subcommand
+func TestUnpackCommand(t *testing.T) {
+	tempDir := t.TempDir()
+	bundle := filepath.Join(tempDir, "bundle.txt")
+	content := "Directory Structure:\n\n└── ./\n    ├── src\n    │   └── lib.go\n    └── main.go\n\n" +
+		"---\nFile: src/lib.go\n---\n\npackage src\n\n\n" +
+		"---\nFile: main.go\n---\n\npackage main\n\n\n"
+	if err := os.WriteFile(bundle, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	outDir := filepath.Join(tempDir, "out")
+
+	// Dry run only lists the files
+	_, stderr, err := executeCommand(t, "unpack", bundle, "-d", outDir, "--dry-run")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stderr, "Would write "+filepath.Join(outDir, "main.go")) {
+		t.Errorf("Expected dry run listing, got: %s", stderr)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Error("Dry run created the output directory")
+	}
+
+	if _, _, err := executeCommand(t, "unpack", bundle, "--dir", outDir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{"main.go": "package main\n", "src/lib.go": "package src\n"}
+	for name, want := range expected {
+		got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+// TestUnpackCommandRejectsTraversal tests that bundles with escaping paths are rejected
+func TestUnpackCommandRejectsTraversal(t *testing.T) {
+	tempDir := t.TempDir()
+	bundle := filepath.Join(tempDir, "bundle.txt")
+	content := "---\nFile: ../escape.go\n---\n\npackage escape\n\n"
+	if err := os.WriteFile(bundle, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+
+	outDir := filepath.Join(tempDir, "out")
+	if _, _, err := executeCommand(t, "unpack", bundle, "-d", outDir); err == nil {
+		t.Error("Expected error for a path escaping the target directory")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "escape.go")); !os.IsNotExist(err) {
+		t.Error("File was written outside the target directory")
+	}
+}
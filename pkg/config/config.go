@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the project configuration file
+const FileName = ".dir2prompt.yaml"
+
+// EnvPrefix is the prefix of environment variables that override configuration values
+const EnvPrefix = "DIR2PROMPT_"
+
+// File holds the contents of a .dir2prompt.yaml file. Option keys are the names of
+// the command line flags, e.g. "include-files" or "exclude-files". Top-level options
+// apply to every run; a profile's options are layered on top of them.
+type File struct {
+	Path     string
+	Defaults map[string]interface{}
+	Profiles map[string]map[string]interface{}
+}
+
+// Find searches startDir and its parent directories for a configuration file.
+// It returns an empty string if none is found.
+func Find(startDir string) (string, error) {
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	for {
+		candidate := filepath.Join(dir, FileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads and parses a configuration file
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	file := &File{
+		Path:     path,
+		Defaults: make(map[string]interface{}),
+		Profiles: make(map[string]map[string]interface{}),
+	}
+
+	for key, value := range raw {
+		if key != "profiles" {
+			file.Defaults[key] = value
+			continue
+		}
+
+		profiles, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid config file %s: 'profiles' must be a mapping", path)
+		}
+		for name, profile := range profiles {
+			options, ok := profile.(map[string]interface{})
+			if !ok && profile != nil {
+				return nil, fmt.Errorf("invalid config file %s: profile '%s' must be a mapping", path, name)
+			}
+			file.Profiles[name] = options
+		}
+	}
+
+	return file, nil
+}
+
+// Values returns the options for the given profile merged over the top-level
+// defaults. Scalars become a single string in their command line form and lists
+// become one string per item. An empty profile name selects only the defaults.
+func (f *File) Values(profile string) (map[string][]string, error) {
+	values := make(map[string][]string)
+
+	merge := func(options map[string]interface{}) error {
+		for key, value := range options {
+			items, err := flagValues(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for '%s' in %s: %w", key, f.Path, err)
+			}
+			values[key] = items
+		}
+		return nil
+	}
+
+	if err := merge(f.Defaults); err != nil {
+		return nil, err
+	}
+
+	if profile != "" {
+		options, ok := f.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile '%s' not found in %s (available: %s)", profile, f.Path, strings.Join(f.ProfileNames(), ", "))
+		}
+		if err := merge(options); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// ProfileNames returns the sorted names of all profiles
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnvName returns the environment variable that overrides the given option
+func EnvName(option string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(option, "-", "_"))
+}
+
+// flagValues converts a YAML value to the string form accepted by the matching flag
+func flagValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("nested collections are not supported")
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		return items, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("mappings are not supported")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file into dir and returns its path
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+// TestFind tests that the config file is discovered in parent directories
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	found, err := Find(nested)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if found != "" {
+		t.Errorf("Find without config = %q, want empty", found)
+	}
+
+	path := writeConfig(t, root, "include-files: \"*.go\"\n")
+	found, err = Find(nested)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if found != path {
+		t.Errorf("Find = %q, want %q", found, path)
+	}
+}
+
+// TestValues tests merging of defaults and profiles
+func TestValues(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+exclude-files: ["*.tmp", "*.log"]
+include-files: "*"
+no-gitignore: false
+profiles:
+  backend:
+    include-files:
+      - "cmd/**"
+      - "pkg/**"
+    no-gitignore: true
+  docs:
+    include-files: "*.md"
+`)
+
+	file, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	testCases := []struct {
+		profile  string
+		expected map[string]string
+	}{
+		{"", map[string]string{"exclude-files": "*.tmp|*.log", "include-files": "*", "no-gitignore": "false"}},
+		{"backend", map[string]string{"exclude-files": "*.tmp|*.log", "include-files": "cmd/**|pkg/**", "no-gitignore": "true"}},
+		{"docs", map[string]string{"exclude-files": "*.tmp|*.log", "include-files": "*.md", "no-gitignore": "false"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run("profile "+tc.profile, func(t *testing.T) {
+			values, err := file.Values(tc.profile)
+			if err != nil {
+				t.Fatalf("Values failed: %v", err)
+			}
+			if len(values) != len(tc.expected) {
+				t.Errorf("Values = %v, want %v", values, tc.expected)
+			}
+			for key, want := range tc.expected {
+				if got := strings.Join(values[key], "|"); got != want {
+					t.Errorf("Values[%s] = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := file.Values("missing"); err == nil {
+		t.Error("Expected error for unknown profile, got nil")
+	}
+}
+
+// TestLoadInvalid tests that malformed config files are rejected
+func TestLoadInvalid(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "profiles: [a, b]\n")
+	if _, err := Load(path); err == nil {
+		t.Error("Expected error for invalid profiles, got nil")
+	}
+}
+
+// TestEnvName tests the environment variable naming
+func TestEnvName(t *testing.T) {
+	if name := EnvName("exclude-files"); name != "DIR2PROMPT_EXCLUDE_FILES" {
+		t.Errorf("EnvName = %q, want DIR2PROMPT_EXCLUDE_FILES", name)
+	}
+}
@@ -0,0 +1,712 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Edit is a change to a single file extracted from a model response: a full-file
+// replacement or the hunks of a unified diff
+type Edit struct {
+	Path    string // Slash-separated path relative to the root
+	Content string // New content of a full-file replacement
+	Create  bool   // The unified diff creates the file
+	Delete  bool   // The unified diff deletes the file
+	hunks   []hunk // Hunks of a unified diff, nil for a full-file replacement
+	line    int    // Line of the response the edit starts on
+}
+
+// hunk is a hunk of a unified diff. Lines keep their ' ', '-' or '+' prefix.
+type hunk struct {
+	oldStart     int // 1-based first line of the old side, 0 when unknown
+	lines        []string
+	oldNoNewline bool // The old side ends without a newline
+	newNoNewline bool // The new side ends without a newline
+}
+
+// FileChange is the result of applying all edits of a file to the working tree
+type FileChange struct {
+	Path   string
+	Target string // Location of the file on disk
+	Old    string // Current content, empty for a new file
+	New    string // Content after applying the edits
+	Exists bool   // The file exists in the working tree
+	Delete bool   // The edits delete the file
+	Err    error  // Why the edits do not apply cleanly
+}
+
+var (
+	// fenceOpenPattern matches the opening line of a fenced code block and its info string
+	fenceOpenPattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^`]*)$")
+	// boundaryDeclarationPattern matches the boundary declared at the top of the text format
+	boundaryDeclarationPattern = regexp.MustCompile(`(?m)^Boundary: \S+$`)
+	// hunkHeaderPattern matches a hunk header with line numbers
+	hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+	// infoPathPattern matches a path attribute in the info string of a code block
+	infoPathPattern = regexp.MustCompile(`(?:^|\s)(?:path|file|filename|title)=["']?([^"'\s]+)`)
+	// commentPathPattern matches a first line such as "// file: main.go"
+	commentPathPattern = regexp.MustCompile(`(?i)^\s*(?://|#|--|;|/\*|<!--)\s*(?:file|filename|path)\s*:\s*(\S+?)\s*(?:\*/|-->)?\s*$`)
+	// pathLikePattern matches a relative path without spaces
+	pathLikePattern = regexp.MustCompile(`^[\w.\-]+(?:/[\w.\-]+)*$`)
+	// labelPrefixPattern matches a label such as "File:" before a path
+	labelPrefixPattern = regexp.MustCompile(`(?i)^(?:file|filename|path)\s*:\s*`)
+)
+
+// fencedBlock is a fenced code block in a model response
+type fencedBlock struct {
+	info      string // Info string after the opening fence
+	content   string
+	line      int    // 1-based line of the opening fence
+	preceding string // Last non-empty line before the block
+}
+
+// ParseEdits extracts file edits from a model response. A response in the dir2prompt
+// text format is read as full-file replacements. Otherwise fenced code blocks
+// annotated with a path become full-file replacements, and unified diffs, fenced or
+// not, become patches. Blocks without a path are ignored.
+func ParseEdits(response string) ([]Edit, error) {
+	if edits := parseDelimitedEdits(response); len(edits) > 0 {
+		return edits, nil
+	}
+
+	lines := strings.Split(response, "\n")
+	blocks, outside := fencedBlocks(lines)
+
+	var edits []Edit
+	for _, b := range blocks {
+		blockLines := strings.Split(strings.TrimSuffix(b.content, "\n"), "\n")
+		info := strings.Fields(b.info)
+		isDiff := len(info) > 0 && (info[0] == "diff" || info[0] == "patch")
+		relPath, strip := blockPath(b.info, b.preceding, blockLines[0])
+
+		if isDiff || looksLikeUnifiedDiff(blockLines) {
+			edits = append(edits, parseUnifiedDiff(blockLines, b.line+1, relPath)...)
+			continue
+		}
+		if relPath == "" {
+			continue
+		}
+		content := b.content
+		if strip {
+			_, content, _ = strings.Cut(content, "\n")
+		}
+		edits = append(edits, Edit{Path: relPath, Content: content, line: b.line})
+	}
+
+	// Unified diffs outside of code blocks
+	edits = append(edits, parseUnifiedDiff(outside, 1, "")...)
+
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("no file edits found: annotate code blocks with a path, use unified diffs or the dir2prompt text format")
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].line < edits[j].line })
+	return edits, nil
+}
+
+// parseDelimitedEdits reads a response in the dir2prompt text format, with "---"
+// headers or a boundary. Contents wrapped in a single code block are unwrapped.
+func parseDelimitedEdits(response string) []Edit {
+	var entries []Entry
+	if loc := boundaryDeclarationPattern.FindStringIndex(response); loc != nil {
+		entries, _ = parseBoundaryBundle(response[loc[0]:])
+	} else if textHeaderPattern.MatchString(response) {
+		entries = parseTextBundle(response)
+	}
+
+	var edits []Edit
+	for _, f := range joinParts(entries) {
+		if f.Skipped != "" {
+			continue
+		}
+		content := unwrapFence(f.Content)
+		// Models often drop the blank line ending a section
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		edits = append(edits, Edit{Path: f.Path, Content: content})
+	}
+	return edits
+}
+
+// unwrapFence returns the content of a code block if the text consists of exactly one
+// code block, and the text itself otherwise
+func unwrapFence(text string) string {
+	lines := strings.Split(strings.Trim(text, "\n"), "\n")
+	blocks, outside := fencedBlocks(lines)
+	if len(blocks) != 1 || blocks[0].line != 1 {
+		return text
+	}
+	for _, line := range outside {
+		if strings.TrimSpace(line) != "" && line != fenceSentinel {
+			return text
+		}
+	}
+	return blocks[0].content
+}
+
+// fenceSentinel replaces the lines of code blocks in the text outside of them, so a
+// diff hunk cannot run into a block
+const fenceSentinel = "\x00"
+
+// fencedBlocks finds the closed code blocks in the lines. It also returns the lines
+// with the blocks replaced by fenceSentinel. Unclosed blocks, e.g. of a truncated
+// response, are ignored.
+func fencedBlocks(lines []string) ([]fencedBlock, []string) {
+	var blocks []fencedBlock
+	outside := append([]string(nil), lines...)
+	preceding := ""
+
+	for i := 0; i < len(lines); i++ {
+		m := fenceOpenPattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			if strings.TrimSpace(lines[i]) != "" {
+				preceding = lines[i]
+			}
+			continue
+		}
+
+		fence := m[1]
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			closing := strings.TrimSpace(lines[j])
+			if len(closing) >= len(fence) && strings.Trim(closing, fence[:1]) == "" {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+
+		var content strings.Builder
+		for _, line := range lines[i+1 : end] {
+			content.WriteString(line + "\n")
+		}
+		blocks = append(blocks, fencedBlock{info: strings.TrimSpace(m[2]), content: content.String(), line: i + 1, preceding: preceding})
+		for j := i; j <= end; j++ {
+			outside[j] = fenceSentinel
+		}
+		preceding = ""
+		i = end
+	}
+	return blocks, outside
+}
+
+// blockPath finds the path a code block is annotated with: a path attribute or a path
+// in the info string, a "file:" comment on the first line, which is then stripped, or
+// a path on the line before the block such as "**src/main.go**"
+func blockPath(info, preceding, firstLine string) (string, bool) {
+	if m := infoPathPattern.FindStringSubmatch(info); m != nil {
+		return m[1], false
+	}
+	fields := strings.Fields(info)
+	if len(fields) > 0 {
+		if _, p, ok := strings.Cut(fields[0], ":"); ok && pathLikePattern.MatchString(p) {
+			return p, false
+		}
+		for _, field := range fields {
+			if looksLikePath(field) {
+				return field, false
+			}
+		}
+	}
+
+	if m := commentPathPattern.FindStringSubmatch(firstLine); m != nil {
+		return m[1], true
+	}
+
+	label := strings.TrimSpace(preceding)
+	decorated := strings.ContainsAny(label, "`*") || strings.HasPrefix(label, "#")
+	label = strings.Trim(strings.TrimLeft(label, "#> "), "*`_: ")
+	if rest := labelPrefixPattern.ReplaceAllString(label, ""); rest != label {
+		label, decorated = strings.Trim(rest, "*`_: "), true
+	}
+	if looksLikePath(label) || (decorated && pathLikePattern.MatchString(label)) {
+		return label, false
+	}
+	return "", false
+}
+
+// looksLikePath reports whether s is a relative path with a directory or a file extension
+func looksLikePath(s string) bool {
+	return pathLikePattern.MatchString(s) && (strings.Contains(s, "/") || strings.Contains(strings.TrimPrefix(s, "."), "."))
+}
+
+// looksLikeUnifiedDiff reports whether the lines contain file headers and a hunk
+func looksLikeUnifiedDiff(lines []string) bool {
+	headers, hunks := false, false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			headers = true
+		}
+		if strings.HasPrefix(line, "@@") {
+			hunks = true
+		}
+	}
+	return headers && hunks
+}
+
+// parseUnifiedDiff extracts the edits of a unified diff. Hunks before the first file
+// header belong to defaultPath, or are ignored if it is empty. firstLine is the line
+// of the response the lines start on.
+func parseUnifiedDiff(lines []string, firstLine int, defaultPath string) []Edit {
+	var edits []Edit
+	current := -1
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if isFileHeader(lines, i) {
+			oldPath, newPath := diffPath(line[4:]), diffPath(lines[i+1][4:])
+			if strings.HasPrefix(oldPath, "a/") && (strings.HasPrefix(newPath, "b/") || newPath == "/dev/null") ||
+				oldPath == "/dev/null" && strings.HasPrefix(newPath, "b/") {
+				oldPath, newPath = strings.TrimPrefix(oldPath, "a/"), strings.TrimPrefix(newPath, "b/")
+			}
+
+			e := Edit{Path: newPath, Create: oldPath == "/dev/null", hunks: []hunk{}, line: firstLine + i}
+			if newPath == "/dev/null" {
+				e.Path, e.Delete = oldPath, true
+			}
+			edits = append(edits, e)
+			current = len(edits) - 1
+			i++
+			continue
+		}
+
+		if !strings.HasPrefix(line, "@@") {
+			continue
+		}
+		if current < 0 {
+			if defaultPath == "" {
+				continue
+			}
+			edits = append(edits, Edit{Path: defaultPath, hunks: []hunk{}, line: firstLine + i})
+			current = len(edits) - 1
+		}
+		h, next := parseHunk(lines, i)
+		edits[current].hunks = append(edits[current].hunks, h)
+		i = next - 1
+	}
+	return edits
+}
+
+// isFileHeader reports whether a "---" and "+++" file header starts at line i
+func isFileHeader(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// diffPath returns the path of a file header, dropping a trailing timestamp
+func diffPath(header string) string {
+	header, _, _ = strings.Cut(header, "\t")
+	return strings.Trim(strings.TrimSpace(header), "\"")
+}
+
+// parseHunk parses the hunk whose header is at line i and returns it with the index of
+// the line after it. The line counts of the header are followed when present; models
+// often strip the space from empty context lines, so those count as context.
+func parseHunk(lines []string, i int) (hunk, int) {
+	var h hunk
+	oldLeft, newLeft := -1, -1
+	if m := hunkHeaderPattern.FindStringSubmatch(lines[i]); m != nil {
+		h.oldStart, _ = strconv.Atoi(m[1])
+		oldLeft, newLeft = 1, 1
+		if m[2] != "" {
+			oldLeft, _ = strconv.Atoi(m[2])
+		}
+		if m[4] != "" {
+			newLeft, _ = strconv.Atoi(m[4])
+		}
+	}
+	counted := oldLeft >= 0
+
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "\\") {
+			if n := len(h.lines); n > 0 {
+				switch h.lines[n-1][0] {
+				case '-':
+					h.oldNoNewline = true
+				case '+':
+					h.newNoNewline = true
+				default:
+					h.oldNoNewline, h.newNoNewline = true, true
+				}
+			}
+			continue
+		}
+		if (counted && oldLeft <= 0 && newLeft <= 0) || strings.HasPrefix(line, "@@") || isFileHeader(lines, i) {
+			break
+		}
+
+		if line == "" {
+			line = " "
+		}
+		switch line[0] {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		default:
+			return h.trimmed(counted), i
+		}
+		h.lines = append(h.lines, line)
+	}
+	return h.trimmed(counted), i
+}
+
+// trimmed drops trailing empty context lines of a hunk without line counts, which are
+// more likely blank lines after the diff
+func (h hunk) trimmed(counted bool) hunk {
+	for !counted && len(h.lines) > 0 && h.lines[len(h.lines)-1] == " " {
+		h.lines = h.lines[:len(h.lines)-1]
+	}
+	return h
+}
+
+// sides returns the lines of the old and new side of a hunk without their prefix
+func (h hunk) sides() ([]string, []string) {
+	var oldLines, newLines []string
+	for _, line := range h.lines {
+		if line[0] != '+' {
+			oldLines = append(oldLines, line[1:])
+		}
+		if line[0] != '-' {
+			newLines = append(newLines, line[1:])
+		}
+	}
+	return oldLines, newLines
+}
+
+// applyHunks applies the hunks to the content in order. A hunk is placed where its old
+// side matches, searching outward from its line number so shifted hunks still apply,
+// first exactly and then ignoring trailing whitespace.
+func applyHunks(content string, hunks []hunk) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	finalNewline := content == "" || strings.HasSuffix(content, "\n")
+
+	var out []string
+	pos, offset := 0, 0
+	for n, h := range hunks {
+		oldLines, newLines := h.sides()
+		hint := pos
+		if h.oldStart > 0 {
+			hint = max(pos, h.oldStart-1+offset)
+		}
+		if len(oldLines) == 0 && h.oldStart > 0 {
+			// Pure insertions are placed after the line given by the header
+			hint = max(pos, h.oldStart+offset)
+		}
+
+		at := findLines(lines, oldLines, hint, pos)
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d (@@ -%d) does not match the file", n+1, h.oldStart)
+		}
+		switch {
+		case len(oldLines) == 0 && h.oldStart > 0:
+			offset = at - h.oldStart
+		case h.oldStart > 0:
+			offset = at - (h.oldStart - 1)
+		}
+
+		out = append(out, lines[pos:at]...)
+		for _, line := range newLines {
+			out = append(out, line+"\n")
+		}
+		pos = at + len(oldLines)
+
+		// Keep or change the missing newline at the end of the file
+		if pos == len(lines) && len(out) > 0 && (h.newNoNewline || (!finalNewline && !h.oldNoNewline)) {
+			out[len(out)-1] = strings.TrimSuffix(out[len(out)-1], "\n")
+		}
+	}
+	out = append(out, lines[pos:]...)
+	return strings.Join(out, ""), nil
+}
+
+// findLines returns the index of the occurrence of want in lines at or after from that
+// is closest to hint, or -1
+func findLines(lines, want []string, hint, from int) int {
+	last := len(lines) - len(want)
+	hint = max(from, hint)
+	if hint > last {
+		hint = last
+	}
+
+	for _, normalize := range []func(string) string{
+		func(s string) string { return strings.TrimSuffix(s, "\n") },
+		func(s string) string { return strings.TrimRight(s, " \t\r\n") },
+	} {
+		matches := func(at int) bool {
+			for i, w := range want {
+				if normalize(lines[at+i]) != normalize(w) {
+					return false
+				}
+			}
+			return true
+		}
+		for d := 0; hint-d >= from || hint+d <= last; d++ {
+			if at := hint - d; at >= from && at <= last && matches(at) {
+				return at
+			}
+			if at := hint + d; d > 0 && at >= from && at <= last && matches(at) {
+				return at
+			}
+		}
+	}
+	return -1
+}
+
+// PlanEdits applies the edits to the files below root in memory. Edits of the same
+// file are applied in order. Edits that do not apply cleanly are reported in the Err
+// of their file. Absolute paths and paths that leave root, also through symbolic
+// links, are rejected with an error.
+func PlanEdits(edits []Edit, root string) ([]FileChange, error) {
+	var changes []FileChange
+	index := make(map[string]int)
+	for _, e := range edits {
+		target, err := safeJoin(root, e.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkTarget(root, target); err != nil {
+			return nil, err
+		}
+
+		relPath := path.Clean(strings.ReplaceAll(e.Path, "\\", "/"))
+		i, ok := index[relPath]
+		if !ok {
+			c := FileChange{Path: relPath, Target: target}
+			data, err := os.ReadFile(target)
+			switch {
+			case err == nil:
+				c.Old, c.Exists = string(data), true
+			case !os.IsNotExist(err):
+				return nil, fmt.Errorf("failed to read file %s: %w", relPath, err)
+			}
+			c.New = c.Old
+			i = len(changes)
+			index[relPath] = i
+			changes = append(changes, c)
+		}
+
+		c := &changes[i]
+		if c.Err != nil {
+			continue
+		}
+		exists := (c.Exists || c.New != "") && !c.Delete
+		switch {
+		case e.hunks == nil:
+			c.New, c.Delete = e.Content, false
+		case e.Create && exists:
+			c.Err = fmt.Errorf("the diff creates the file, but it already exists")
+		case !e.Create && !exists:
+			c.Err = fmt.Errorf("the diff changes the file, but it does not exist")
+		default:
+			updated, err := applyHunks(c.New, e.hunks)
+			if err != nil {
+				c.Err = err
+				continue
+			}
+			c.New, c.Delete = updated, e.Delete
+		}
+	}
+	return changes, nil
+}
+
+// checkTarget verifies that the nearest existing directory of target resolves inside
+// root and that target is not a symbolic link
+func checkTarget(root, target string) error {
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to write %s: it is a symbolic link", target)
+	}
+
+	dir := filepath.Dir(target)
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return checkInside(root, dir)
+}
+
+// Changed reports whether the change modifies the working tree
+func (c FileChange) Changed() bool {
+	return c.Err == nil && (c.Delete && c.Exists || !c.Delete && (c.New != c.Old || !c.Exists))
+}
+
+// WriteChanges writes the changed files, creating directories as needed and keeping
+// the permissions of existing files
+func WriteChanges(changes []FileChange, log io.Writer) error {
+	for _, c := range changes {
+		if !c.Changed() {
+			continue
+		}
+
+		if c.Delete {
+			if err := os.Remove(c.Target); err != nil {
+				return fmt.Errorf("failed to delete file %s: %w", c.Path, err)
+			}
+			fmt.Fprintf(log, "Deleted %s\n", c.Path)
+			continue
+		}
+
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(c.Target); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := os.MkdirAll(filepath.Dir(c.Target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(c.Target, []byte(c.New), perm); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", c.Path, err)
+		}
+		if c.Exists {
+			fmt.Fprintf(log, "Updated %s\n", c.Path)
+		} else {
+			fmt.Fprintf(log, "Created %s\n", c.Path)
+		}
+	}
+	return nil
+}
+
+// ANSI escape sequences of the colored diff
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// diffContext is the number of unchanged lines shown around changes
+const diffContext = 3
+
+// diffOp is a line of a line-oriented diff with its ' ', '-' or '+' operation
+type diffOp struct {
+	op   byte
+	text string // Line including its newline, if any
+}
+
+// Diff renders the change as a unified diff, with ANSI colors if color is set
+func (c FileChange) Diff(color bool) string {
+	if !c.Changed() {
+		return ""
+	}
+
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	oldName, newName := "a/"+c.Path, "b/"+c.Path
+	newContent := c.New
+	if !c.Exists {
+		oldName = "/dev/null"
+	}
+	if c.Delete {
+		newName, newContent = "/dev/null", ""
+	}
+
+	var ops []diffOp
+	for _, d := range diff.Do(c.Old, newContent) {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, line := range strings.SplitAfter(d.Text, "\n") {
+			if line != "" {
+				ops = append(ops, diffOp{op, line})
+			}
+		}
+	}
+
+	// Line numbers on both sides before each operation
+	oldLine, newLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, o := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if o.op != '+' {
+			oldLine[i+1]++
+		}
+		if o.op != '-' {
+			newLine[i+1]++
+		}
+	}
+	rangeOf := func(lines []int, start, end int) string {
+		count := lines[end] - lines[start]
+		first := lines[start] + 1
+		if count == 0 {
+			first--
+		}
+		return fmt.Sprintf("%d,%d", first, count)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(paint(colorBold, "--- "+oldName) + "\n")
+	sb.WriteString(paint(colorBold, "+++ "+newName) + "\n")
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk over changes separated by little context
+		start, end := max(0, i-diffContext), i
+		for {
+			for end < len(ops) && ops[end].op != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].op == ' ' {
+				next++
+			}
+			if next < len(ops) && next-end <= 2*diffContext {
+				end = next
+				continue
+			}
+			end = min(len(ops), end+diffContext)
+			break
+		}
+
+		header := fmt.Sprintf("@@ -%s +%s @@", rangeOf(oldLine, start, end), rangeOf(newLine, start, end))
+		sb.WriteString(paint(colorCyan, header) + "\n")
+		for _, o := range ops[start:end] {
+			line := string(o.op) + strings.TrimSuffix(o.text, "\n")
+			switch o.op {
+			case '-':
+				line = paint(colorRed, line)
+			case '+':
+				line = paint(colorGreen, line)
+			}
+			sb.WriteString(line + "\n")
+			if !strings.HasSuffix(o.text, "\n") {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
@@ -0,0 +1,281 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseEdits tests extracting edits from the supported response styles
+func TestParseEdits(t *testing.T) {
+	testCases := []struct {
+		name     string
+		response string
+		expected []Edit
+	}{
+		{
+			name:     "delimited format",
+			response: "Here you go:\n\n---\nFile: main.go\n---\n\npackage main\n\n\n---\nFile: src/lib.go\n---\n\n```go\npackage src\n```\n",
+			expected: []Edit{{Path: "main.go", Content: "package main\n"}, {Path: "src/lib.go", Content: "package src\n"}},
+		},
+		{
+			name:     "boundary format",
+			response: "Boundary: dir2prompt-x\n\n--dir2prompt-x\nFile: a.go\n\npackage a\n--dir2prompt-x--\nDone.\n",
+			expected: []Edit{{Path: "a.go", Content: "package a\n"}},
+		},
+		{
+			name: "annotated code blocks",
+			response: "```go path=a.go\npackage a\n```\n\n" +
+				"```go:b.go\npackage b\n```\n\n" +
+				"```go\n// file: c.go\npackage c\n```\n\n" +
+				"**`src/d.go`**\n\n```go\npackage d\n```\n\n" +
+				"### Makefile\n\n```make\nall:\n```\n\n" +
+				"An unrelated snippet:\n\n```go\nfmt.Println()\n```\n",
+			expected: []Edit{
+				{Path: "a.go", Content: "package a\n"},
+				{Path: "b.go", Content: "package b\n"},
+				{Path: "c.go", Content: "package c\n"},
+				{Path: "src/d.go", Content: "package d\n"},
+				{Path: "Makefile", Content: "all:\n"},
+			},
+		},
+		{
+			name:     "unclosed block is ignored",
+			response: "```go path=a.go\npackage a\n",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			edits, err := ParseEdits(tc.response)
+			if tc.expected == nil {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", edits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEdits error: %v", err)
+			}
+			if len(edits) != len(tc.expected) {
+				t.Fatalf("Expected %d edits, got %+v", len(tc.expected), edits)
+			}
+			for i, e := range tc.expected {
+				if edits[i].Path != e.Path || edits[i].Content != e.Content || edits[i].hunks != nil {
+					t.Errorf("edit %d = %+v, want %+v", i, edits[i], e)
+				}
+			}
+		})
+	}
+}
+
+// TestParseEditsUnifiedDiff tests extracting unified diffs, fenced or not
+func TestParseEditsUnifiedDiff(t *testing.T) {
+	response := "Change the greeting:\n\n```diff\n--- a/main.go\n+++ b/main.go\n@@ -1,3 +1,3 @@\n package main\n\n-var greeting = \"hi\"\n+var greeting = \"hello\"\n```\n\n" +
+		"And add a file:\n\n--- /dev/null\n+++ b/docs/new.md\n@@ -0,0 +1,2 @@\n+# New\n+text\n\nThat's all.\n"
+
+	edits, err := ParseEdits(response)
+	if err != nil {
+		t.Fatalf("ParseEdits error: %v", err)
+	}
+	if len(edits) != 2 {
+		t.Fatalf("Expected 2 edits, got %+v", edits)
+	}
+	if edits[0].Path != "main.go" || len(edits[0].hunks) != 1 || len(edits[0].hunks[0].lines) != 4 {
+		t.Errorf("Unexpected first edit: %+v", edits[0])
+	}
+	if edits[1].Path != "docs/new.md" || !edits[1].Create || len(edits[1].hunks[0].lines) != 2 {
+		t.Errorf("Unexpected second edit: %+v", edits[1])
+	}
+}
+
+// TestApplyHunks tests placing hunks, including shifted hunks and missing newlines
+func TestApplyHunks(t *testing.T) {
+	original := "one\ntwo\nthree\nfour\nfive\nsix\n"
+	testCases := []struct {
+		name     string
+		content  string
+		diff     string
+		expected string
+		fails    bool
+	}{
+		{
+			name:     "exact",
+			content:  original,
+			diff:     "@@ -2,3 +2,3 @@\n two\n-three\n+THREE\n four\n",
+			expected: "one\ntwo\nTHREE\nfour\nfive\nsix\n",
+		},
+		{
+			name:     "shifted",
+			content:  "zero\n" + original,
+			diff:     "@@ -5,2 +5,3 @@\n five\n+five and a half\n six\n",
+			expected: "zero\none\ntwo\nthree\nfour\nfive\nfive and a half\nsix\n",
+		},
+		{
+			name:     "without line numbers",
+			content:  original,
+			diff:     "@@ @@\n one\n-two\n+2\n",
+			expected: "one\n2\nthree\nfour\nfive\nsix\n",
+		},
+		{
+			name:     "stripped blank context",
+			content:  "a\n\nb\n",
+			diff:     "@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n",
+			expected: "a\n\nc\n",
+		},
+		{
+			name:     "add missing newline",
+			content:  "a\nb",
+			diff:     "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+			expected: "a\nb\n",
+		},
+		{
+			name:     "keep missing newline",
+			content:  "a\nb",
+			diff:     "@@ -1,2 +1,2 @@\n-a\n+A\n b\n",
+			expected: "A\nb",
+		},
+		{
+			name:     "insertions without context",
+			content:  "a\nb\nc\nd\ne\n",
+			diff:     "@@ -1,0 +2,1 @@\n+X\n@@ -3,0 +5,1 @@\n+Y\n",
+			expected: "a\nX\nb\nc\nY\nd\ne\n",
+		},
+		{
+			name:    "mismatch",
+			content: original,
+			diff:    "@@ -2,2 +2,2 @@\n two\n-THREE\n+3\n",
+			fails:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			edits := parseUnifiedDiff(strings.Split(tc.diff, "\n"), 1, "file.txt")
+			if len(edits) != 1 {
+				t.Fatalf("Expected 1 edit, got %d", len(edits))
+			}
+			result, err := applyHunks(tc.content, edits[0].hunks)
+			if tc.fails {
+				if err == nil {
+					t.Errorf("Expected error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyHunks error: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("result = %q, want %q", result, tc.expected)
+			}
+		})
+	}
+}
+
+// TestPlanAndWriteChanges tests applying edits to a working tree
+func TestPlanAndWriteChanges(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nvar x = 1\n"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "old.txt"), []byte("obsolete\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	response := "```diff\n--- a/main.go\n+++ b/main.go\n@@ -3 +3 @@\n-var x = 1\n+var x = 2\n--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-obsolete\n```\n\n" +
+		"```text path=docs/new.txt\nnew\n```\n"
+	edits, err := ParseEdits(response)
+	if err != nil {
+		t.Fatalf("ParseEdits error: %v", err)
+	}
+	changes, err := PlanEdits(edits, root)
+	if err != nil {
+		t.Fatalf("PlanEdits error: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %+v", changes)
+	}
+	for _, c := range changes {
+		if c.Err != nil || !c.Changed() {
+			t.Errorf("Unexpected change %s: %v", c.Path, c.Err)
+		}
+	}
+
+	diff := changes[0].Diff(false)
+	if !strings.Contains(diff, "--- a/main.go\n+++ b/main.go\n@@ -1,3 +1,3 @@\n package main\n \n-var x = 1\n+var x = 2\n") {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+	if colored := changes[0].Diff(true); !strings.Contains(colored, colorRed+"-var x = 1"+colorReset) {
+		t.Errorf("Expected colored diff:\n%q", colored)
+	}
+	if !strings.Contains(changes[2].Diff(false), "--- /dev/null\n+++ b/docs/new.txt\n@@ -0,0 +1,1 @@\n+new\n") {
+		t.Errorf("Unexpected diff for new file:\n%s", changes[2].Diff(false))
+	}
+
+	var log strings.Builder
+	if err := WriteChanges(changes, &log); err != nil {
+		t.Fatalf("WriteChanges error: %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if string(content) != "package main\n\nvar x = 2\n" {
+		t.Errorf("main.go = %q", content)
+	}
+	if info, err := os.Stat(filepath.Join(root, "main.go")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Permissions of main.go not kept: %v", info.Mode())
+	}
+	if _, err := os.Stat(filepath.Join(root, "old.txt")); !os.IsNotExist(err) {
+		t.Error("old.txt was not deleted")
+	}
+	if content, _ := os.ReadFile(filepath.Join(root, "docs", "new.txt")); string(content) != "new\n" {
+		t.Errorf("docs/new.txt = %q", content)
+	}
+	for _, msg := range []string{"Updated main.go", "Deleted old.txt", "Created docs/new.txt"} {
+		if !strings.Contains(log.String(), msg) {
+			t.Errorf("Log missing %q:\n%s", msg, log.String())
+		}
+	}
+}
+
+// TestPlanEditsConflicts tests edits that do not apply cleanly
+func TestPlanEditsConflicts(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	testCases := map[string]string{
+		"context mismatch": "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-b\n+c\n",
+		"create existing":  "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+a\n",
+		"change missing":   "--- a/missing.txt\n+++ b/missing.txt\n@@ -1 +1 @@\n-a\n+b\n",
+	}
+	for name, response := range testCases {
+		edits, err := ParseEdits(response)
+		if err != nil {
+			t.Fatalf("%s: ParseEdits error: %v", name, err)
+		}
+		changes, err := PlanEdits(edits, root)
+		if err != nil {
+			t.Fatalf("%s: PlanEdits error: %v", name, err)
+		}
+		if len(changes) != 1 || changes[0].Err == nil || changes[0].Changed() {
+			t.Errorf("%s: expected a failed change, got %+v", name, changes)
+		}
+	}
+}
+
+// TestPlanEditsOutsideRoot tests that edits outside the root are refused
+func TestPlanEditsOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+
+	for _, relPath := range []string{"../escape.go", "/etc/passwd", "link/escape.go", "link/new/dir/escape.go"} {
+		if _, err := PlanEdits([]Edit{{Path: relPath, Content: "x\n"}}, root); err == nil {
+			t.Errorf("Expected error for %s", relPath)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Boundary modes of the text format
+const (
+	// BoundaryAuto uses the classic "---" headers unless an included file contains text
+	// that could be mistaken for one, in which case a hash boundary is used
+	BoundaryAuto = "auto"
+	// BoundaryHash derives the boundary from a hash of the included files, so the same
+	// input always produces the same output
+	BoundaryHash = "hash"
+	// BoundaryRandom picks a random boundary
+	BoundaryRandom = "random"
+	// BoundaryNone always uses the classic "---" headers
+	BoundaryNone = "none"
+)
+
+// boundaryPrefix starts every generated boundary
+const boundaryPrefix = "dir2prompt-"
+
+// headerPattern matches text that looks like a classic text format header
+var headerPattern = regexp.MustCompile(`(?m)^---\r?\n(?:File|Git Diff|Chunk): `)
+
+// validateBoundaryMode checks the boundary mode
+func validateBoundaryMode(mode string) error {
+	switch mode {
+	case "", BoundaryAuto, BoundaryHash, BoundaryRandom, BoundaryNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown boundary mode '%s' (available: %s, %s, %s, %s)", mode, BoundaryAuto, BoundaryHash, BoundaryRandom, BoundaryNone)
+	}
+}
+
+// chooseBoundary reads the matched files and returns the boundary to separate them
+// with, or an empty string for the classic headers. Only the text format uses boundaries.
+// Files are read one at a time and only a hash of them is kept, so memory stays
+// bounded by the files read concurrently.
+func (p *Processor) chooseBoundary(matchedFiles []string, texts ...string) (string, error) {
+	mode := p.config.Boundary
+	if mode == "" {
+		mode = BoundaryAuto
+	}
+	if p.template != nil || (p.config.Format != "" && p.config.Format != FormatText) || mode == BoundaryNone {
+		return "", nil
+	}
+
+	// Only contents containing the boundary prefix can contain a generated boundary, so
+	// these are the only ones checked again once the boundary is known
+	hash := sha256.New()
+	var candidateTexts []string
+	for _, text := range texts {
+		writeHashed(hash, []byte(text))
+		if strings.Contains(text, boundaryPrefix) {
+			candidateTexts = append(candidateTexts, text)
+		}
+	}
+	var candidates []string
+	collision := ""
+	if err := p.readFiles(matchedFiles, func(relPath string, content []byte) error {
+		slashPath := filepath.ToSlash(relPath)
+		if collision == "" && headerPattern.Match(content) {
+			collision = slashPath
+		}
+		writeHashed(hash, []byte(slashPath))
+		writeHashed(hash, content)
+		if strings.Contains(slashPath, boundaryPrefix) || bytes.Contains(content, []byte(boundaryPrefix)) {
+			candidates = append(candidates, relPath)
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	if mode == BoundaryAuto {
+		if collision == "" {
+			return "", nil
+		}
+		fmt.Fprintf(os.Stderr, "Note: Using boundary delimiters because %s contains text that looks like a file header\n", collision)
+		mode = BoundaryHash
+	}
+
+	return generateBoundary(hash.Sum(nil), mode == BoundaryRandom, func(boundary string) (bool, error) {
+		if containsAny(candidateTexts, boundary) {
+			return true, nil
+		}
+		found := false
+		err := p.readFiles(candidates, func(relPath string, content []byte) error {
+			if strings.Contains(filepath.ToSlash(relPath), boundary) || bytes.Contains(content, []byte(boundary)) {
+				found = true
+			}
+			return nil
+		})
+		return found, err
+	})
+}
+
+// writeHashed adds a content to the hash the boundary is derived from
+func writeHashed(hash io.Writer, content []byte) {
+	fmt.Fprintf(hash, "%d:", len(content))
+	hash.Write(content)
+}
+
+// generateBoundary returns a boundary for which occurs reports false. It is derived
+// from sum, the hash of the contents, unless random is set.
+func generateBoundary(sum []byte, random bool, occurs func(boundary string) (bool, error)) (string, error) {
+	for attempt := 0; ; attempt++ {
+		var id []byte
+		if random {
+			id = make([]byte, 12)
+			if _, err := rand.Read(id); err != nil {
+				return "", fmt.Errorf("failed to generate boundary: %w", err)
+			}
+		} else {
+			// Rehash with a counter in the unlikely case the boundary occurs in the input
+			h := sha256.New()
+			h.Write(sum)
+			fmt.Fprintf(h, "%d", attempt)
+			id = h.Sum(nil)[:12]
+		}
+
+		boundary := boundaryPrefix + hex.EncodeToString(id)
+		found, err := occurs(boundary)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return boundary, nil
+		}
+	}
+}
+
+// containsAny reports whether any of the contents contains s
+func containsAny(contents []string, s string) bool {
+	for _, content := range contents {
+		if strings.Contains(content, s) {
+			return true
+		}
+	}
+	return false
+}
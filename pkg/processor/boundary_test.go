@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerateBoundary tests that boundaries are deterministic and absent from the content
+func TestGenerateBoundary(t *testing.T) {
+	contents := []string{"package main\n", "# Notes\n"}
+	generate := func(contents []string, random bool) string {
+		t.Helper()
+		hash := sha256.New()
+		for _, content := range contents {
+			writeHashed(hash, []byte(content))
+		}
+		boundary, err := generateBoundary(hash.Sum(nil), random, func(boundary string) (bool, error) {
+			return containsAny(contents, boundary), nil
+		})
+		if err != nil {
+			t.Fatalf("generateBoundary error: %v", err)
+		}
+		return boundary
+	}
+
+	first := generate(contents, false)
+	if second := generate(contents, false); first != second {
+		t.Errorf("Hash boundary is not deterministic: %s != %s", first, second)
+	}
+	if !strings.HasPrefix(first, boundaryPrefix) {
+		t.Errorf("Boundary %s lacks prefix %s", first, boundaryPrefix)
+	}
+
+	// A file containing the boundary forces a different one
+	colliding := append(contents, "--"+first+"\n")
+	if third := generate(colliding, false); containsAny(colliding, third) {
+		t.Errorf("Boundary %s occurs in the content", third)
+	}
+
+	random := generate(contents, true)
+	if random == first || !strings.HasPrefix(random, boundaryPrefix) {
+		t.Errorf("Unexpected random boundary %s", random)
+	}
+}
+
+// TestTextFormatBoundary tests the text format with a boundary
+func TestTextFormatBoundary(t *testing.T) {
+	entries, diff := formatTestEntries()
+	output, err := renderDocument(func() (Formatter, error) {
+		return &textFormatter{boundary: "dir2prompt-b"}, nil
+	}, Document{Root: "root", Tree: "tree\n"}, entries, diff)
+	if err != nil {
+		t.Fatalf("renderDocument error: %v", err)
+	}
+
+	expected := "Boundary: dir2prompt-b\n\n" +
+		"Directory Structure:\n\ntree\n\n" +
+		"--dir2prompt-b\nFile: main.go\n\n" + trickyContent + "\n" +
+		"--dir2prompt-b\nFile: docs/README.md\n\n# Title\n\n" +
+		"--dir2prompt-b\nGit Diff: changes since main\n\n+added line\n\n" +
+		"--dir2prompt-b--\n"
+	if output != expected {
+		t.Errorf("Unexpected text output:\n%q\nwant:\n%q", output, expected)
+	}
+}
+
+// TestChooseBoundary tests when a boundary replaces the classic headers
+func TestChooseBoundary(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"plain.go":  "package main\n",
+		"prior.txt": "Directory Structure:\n\n---\nFile: main.go\n---\n\npackage main\n",
+	})
+
+	testCases := []struct {
+		name     string
+		files    []string
+		mode     string
+		format   string
+		boundary bool
+	}{
+		{"auto without collision", []string{"plain.go"}, "", "", false},
+		{"auto with collision", []string{"plain.go", "prior.txt"}, BoundaryAuto, "", true},
+		{"hash", []string{"plain.go"}, BoundaryHash, FormatText, true},
+		{"random", []string{"plain.go"}, BoundaryRandom, "", true},
+		{"none", []string{"prior.txt"}, BoundaryNone, "", false},
+		{"other format", []string{"prior.txt"}, BoundaryHash, FormatXML, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"*"}, Boundary: tc.mode, Format: tc.format})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			boundary, err := p.chooseBoundary(tc.files)
+			if err != nil {
+				t.Fatalf("chooseBoundary error: %v", err)
+			}
+			if (boundary != "") != tc.boundary {
+				t.Errorf("boundary = %q, want boundary: %v", boundary, tc.boundary)
+			}
+		})
+	}
+
+	if _, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"*"}, Boundary: "mime"}); err == nil {
+		t.Error("Expected error for unknown boundary mode")
+	}
+}
+
+// TestProcessWithBoundary tests that a prior output is embedded unambiguously
+func TestProcessWithBoundary(t *testing.T) {
+	tempDir := t.TempDir()
+	prior := "---\nFile: main.go\n---\n\npackage main\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "prior.txt"), []byte(prior), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	stdout, stderr := runProcess(t, Config{DirPath: tempDir, IncludeFiles: []string{"*.txt"}})
+	if !strings.HasPrefix(stdout, "Boundary: "+boundaryPrefix) {
+		t.Fatalf("Expected boundary declaration, got:\n%s", stdout)
+	}
+	boundary := strings.TrimPrefix(strings.SplitN(stdout, "\n", 2)[0], "Boundary: ")
+	if !strings.Contains(stdout, "--"+boundary+"\nFile: prior.txt\n\n"+prior+"\n--"+boundary+"--\n") {
+		t.Errorf("Unexpected output:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "prior.txt contains text that looks like a file header") {
+		t.Errorf("Expected note about the boundary, got: %s", stderr)
+	}
+}
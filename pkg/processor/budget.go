@@ -0,0 +1,341 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RankByRecency ranks recently modified files first
+	RankByRecency = "recency"
+	// RankBySize ranks smaller files first
+	RankBySize = "size"
+	// RankByDepth ranks files closer to the scanned directory first
+	RankByDepth = "depth"
+)
+
+// defaultRankBy breaks ties between files with the same priority when no order is configured
+var defaultRankBy = []string{RankByDepth, RankBySize}
+
+// How a file is represented in the output under a token budget
+const (
+	entryFull     = "full"
+	entryOutline  = "outline"
+	entryPathOnly = "path-only"
+	entryDropped  = "dropped"
+)
+
+// outlinePattern matches declaration lines kept when a file is reduced to its outline:
+// functions, types, classes and similar definitions in common languages, and Markdown headings
+var outlinePattern = regexp.MustCompile(`^\s*(?:(?:export|public|private|protected|internal|static|abstract|final|async|default|pub(?:\([^)]*\))?)\s+)*` +
+	`(?:func|type|class|interface|struct|enum|trait|impl|def|fn|function|module|namespace|package|const|var|let|record|object|resource|variable|output|data)\b|^#{1,6}\s`)
+
+// priorityRule raises or lowers the rank of the files matching a pattern
+type priorityRule struct {
+	pattern string
+	matcher pathMatcher
+	weight  int
+}
+
+// budgetFile is a candidate file considered by the budget planner
+type budgetFile struct {
+	relPath string
+	content []byte
+	modTime time.Time
+	score   int
+}
+
+// budgetEntry records how a file is represented in the output
+type budgetEntry struct {
+	mode       string
+	content    []byte // Content written for the file, nil when dropped
+	size       int    // Size of the complete file in bytes
+	fullTokens int    // Tokens of the complete file entry
+	tokens     int    // Tokens of the entry actually written
+	reason     string // Why the file was not included in full
+}
+
+// budgetPlan is the result of fitting the matched files into a token budget
+type budgetPlan struct {
+	budget  int
+	fixed   int      // Tokens of the output that is always written, such as the directory structure
+	ranked  []string // Relative paths from the highest to the lowest priority
+	entries map[string]*budgetEntry
+}
+
+// parsePriorityRule parses a "pattern=weight" rule. Higher weights rank first and
+// negative weights push matching files to the end.
+func parsePriorityRule(rule, globMode string) (priorityRule, error) {
+	idx := strings.LastIndex(rule, "=")
+	if idx <= 0 {
+		return priorityRule{}, fmt.Errorf("invalid priority rule '%s': expected pattern=weight", rule)
+	}
+
+	pattern := rule[:idx]
+	weight, err := strconv.Atoi(strings.TrimSpace(rule[idx+1:]))
+	if err != nil {
+		return priorityRule{}, fmt.Errorf("invalid priority rule '%s': weight must be an integer", rule)
+	}
+
+	m, err := compileGlob(pattern, globMode)
+	if err != nil {
+		return priorityRule{}, fmt.Errorf("invalid priority pattern '%s': %w", pattern, err)
+	}
+
+	return priorityRule{pattern: pattern, matcher: m, weight: weight}, nil
+}
+
+// validateRankBy checks the tie-breaking criteria
+func validateRankBy(rankBy []string) error {
+	for _, criterion := range rankBy {
+		switch criterion {
+		case RankByRecency, RankBySize, RankByDepth:
+		default:
+			return fmt.Errorf("unknown rank criterion '%s' (available: %s, %s, %s)", criterion, RankByRecency, RankBySize, RankByDepth)
+		}
+	}
+	return nil
+}
+
+// priorityScore sums the weights of all priority rules matching the path
+func (p *Processor) priorityScore(relPath string) int {
+	score := 0
+	for _, rule := range p.priorities {
+		if rule.matcher.Match(relPath) {
+			score += rule.weight
+		}
+	}
+	return score
+}
+
+// rankFiles sorts files by descending priority score, then by the tie-breaking
+// criteria in order, keeping the path order for files that compare equal
+func rankFiles(files []*budgetFile, rankBy []string) {
+	if len(rankBy) == 0 {
+		rankBy = defaultRankBy
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		for _, criterion := range rankBy {
+			switch criterion {
+			case RankByRecency:
+				if !a.modTime.Equal(b.modTime) {
+					return a.modTime.After(b.modTime)
+				}
+			case RankBySize:
+				if len(a.content) != len(b.content) {
+					return len(a.content) < len(b.content)
+				}
+			case RankByDepth:
+				da, db := strings.Count(a.relPath, "/"), strings.Count(b.relPath, "/")
+				if da != db {
+					return da < db
+				}
+			}
+		}
+		return false
+	})
+}
+
+// outline returns the declaration lines of the content and the total number of lines
+func outline(content []byte) ([]string, int) {
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	var kept []string
+	for _, line := range lines {
+		if outlinePattern.MatchString(line) {
+			kept = append(kept, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	return kept, len(lines)
+}
+
+// planBudget reads the matched files and decides how each one is written so that the
+// output, including the directory structure and the diff, fits into MaxTokens
+func (p *Processor) planBudget(matchedFiles []string, doc Document, diffEntry *Entry) (*budgetPlan, error) {
+	files := make([]*budgetFile, 0, len(matchedFiles))
+	if err := p.readFiles(matchedFiles, func(relPath string, content []byte) error {
+		// Files read from a revision share the commit time, so recency only applies to the working tree
+		var modTime time.Time
+		if p.revisionFiles == nil {
+			info, err := os.Stat(filepath.Join(p.config.DirPath, relPath))
+			if err != nil {
+				return fmt.Errorf("failed to stat file %s: %w", relPath, err)
+			}
+			modTime = info.ModTime()
+		}
+
+		slashPath := filepath.ToSlash(relPath)
+		files = append(files, &budgetFile{
+			relPath: slashPath,
+			content: content,
+			modTime: modTime,
+			score:   p.priorityScore(slashPath),
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	fixed, err := renderDocument(p.newFormatter, doc, nil, diffEntry)
+	if err != nil {
+		return nil, err
+	}
+	fixedTokens, err := p.estimateTokens(fixed)
+	if err != nil {
+		return nil, err
+	}
+
+	rankFiles(files, p.config.RankBy)
+	return buildBudgetPlan(files, p.config.MaxTokens, fixedTokens, p.newFormatter, p.estimateTokens)
+}
+
+// buildBudgetPlan fits ranked files into the budget. Every file first gets a path-only
+// entry, dropping the lowest ranked ones if even those do not fit. Files are then
+// upgraded in rank order to their full content, or to their outline, whenever the
+// additional tokens still fit.
+func buildBudgetPlan(files []*budgetFile, budget, fixedTokens int, newFormatter formatterFactory, count func(string) (int, error)) (*budgetPlan, error) {
+	plan := &budgetPlan{
+		budget:  budget,
+		fixed:   fixedTokens,
+		entries: make(map[string]*budgetEntry),
+	}
+
+	fileTokens := func(relPath string, content []byte) (int, error) {
+		return entryTokens(newFormatter, newEntry(relPath, content), false, count)
+	}
+
+	type candidate struct {
+		file           *budgetFile
+		pathOnly       []byte
+		pathOnlyTokens int
+		outline        []byte
+		outlineTokens  int
+	}
+
+	candidates := make([]*candidate, 0, len(files))
+	used := fixedTokens
+	for _, f := range files {
+		plan.ranked = append(plan.ranked, f.relPath)
+
+		fullTokens, err := fileTokens(f.relPath, f.content)
+		if err != nil {
+			return nil, err
+		}
+		c := &candidate{file: f}
+		c.pathOnly = []byte(fmt.Sprintf("[Content omitted to fit the token budget: %d tokens]\n", fullTokens))
+		if c.pathOnlyTokens, err = fileTokens(f.relPath, c.pathOnly); err != nil {
+			return nil, err
+		}
+		if lines, total := outline(f.content); len(lines) > 0 && len(lines) < total {
+			c.outline = []byte(fmt.Sprintf("[Outline only, %d of %d lines shown to fit the token budget]\n%s\n", len(lines), total, strings.Join(lines, "\n")))
+			if c.outlineTokens, err = fileTokens(f.relPath, c.outline); err != nil {
+				return nil, err
+			}
+		}
+
+		plan.entries[f.relPath] = &budgetEntry{
+			mode:       entryPathOnly,
+			content:    c.pathOnly,
+			size:       len(f.content),
+			fullTokens: fullTokens,
+			tokens:     c.pathOnlyTokens,
+		}
+		candidates = append(candidates, c)
+		used += c.pathOnlyTokens
+	}
+
+	// Drop the lowest ranked files until every remaining file can at least be listed
+	for i := len(candidates) - 1; i >= 0 && used > budget; i-- {
+		entry := plan.entries[candidates[i].file.relPath]
+		used -= entry.tokens
+		entry.mode = entryDropped
+		entry.content = nil
+		entry.tokens = 0
+		entry.reason = "no room left for a path-only entry"
+	}
+
+	// Upgrade files in rank order while the budget allows
+	for _, c := range candidates {
+		entry := plan.entries[c.file.relPath]
+		if entry.mode == entryDropped {
+			continue
+		}
+
+		available := budget - used + entry.tokens
+		switch {
+		case entry.fullTokens <= available:
+			entry.mode = entryFull
+			entry.content = c.file.content
+			used += entry.fullTokens - entry.tokens
+			entry.tokens = entry.fullTokens
+		case c.outline != nil && c.outlineTokens <= available:
+			entry.mode = entryOutline
+			entry.content = c.outline
+			used += c.outlineTokens - entry.tokens
+			entry.tokens = c.outlineTokens
+			entry.reason = fmt.Sprintf("full content needs %d tokens, %d available", entry.fullTokens, available)
+		case c.outline != nil:
+			entry.reason = fmt.Sprintf("full content needs %d tokens and outline %d, %d available", entry.fullTokens, c.outlineTokens, available)
+		default:
+			entry.reason = fmt.Sprintf("full content needs %d tokens, %d available, no outline could be extracted", entry.fullTokens, available)
+		}
+	}
+
+	return plan, nil
+}
+
+// entry returns the output entry of a file, or false if the file was dropped
+func (plan *budgetPlan) entry(relPath string) (Entry, bool) {
+	relPath = filepath.ToSlash(relPath)
+	planned := plan.entries[relPath]
+	if planned.mode == entryDropped {
+		return Entry{}, false
+	}
+
+	e := newEntry(relPath, planned.content)
+	e.Mode = planned.mode
+	e.Size = planned.size
+	return e, true
+}
+
+// used returns the number of tokens the planned output takes
+func (plan *budgetPlan) used() int {
+	used := plan.fixed
+	for _, entry := range plan.entries {
+		used += entry.tokens
+	}
+	return used
+}
+
+// report writes a summary of the plan and every file that was not included in full
+func (plan *budgetPlan) report(w io.Writer) {
+	counts := make(map[string]int)
+	for _, entry := range plan.entries {
+		counts[entry.mode]++
+	}
+
+	fmt.Fprintf(w, "\nToken budget: %d of %d tokens used (%d full, %d outline, %d path-only, %d dropped)\n",
+		plan.used(), plan.budget, counts[entryFull], counts[entryOutline], counts[entryPathOnly], counts[entryDropped])
+	if plan.fixed > plan.budget {
+		fmt.Fprintf(w, "  the directory structure alone needs %d tokens\n", plan.fixed)
+	}
+
+	for _, relPath := range plan.ranked {
+		entry := plan.entries[relPath]
+		if entry.mode == entryFull {
+			continue
+		}
+		fmt.Fprintf(w, "  %-9s %s: %s\n", entry.mode, relPath, entry.reason)
+	}
+}
@@ -0,0 +1,192 @@
+package processor
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countWords is a deterministic token counter used instead of the real tokenizer
+func countWords(text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+// TestParsePriorityRule tests parsing of pattern=weight rules
+func TestParsePriorityRule(t *testing.T) {
+	testCases := []struct {
+		rule      string
+		weight    int
+		match     string
+		expectErr bool
+	}{
+		{"cmd/**=10", 10, "cmd/root.go", false},
+		{"*_test.go=-5", -5, "pkg/a_test.go", false},
+		{"a=b=3", 3, "a=b", false},
+		{"*.go", 0, "", true},
+		{"=5", 0, "", true},
+		{"*.go=high", 0, "", true},
+		{"[=1", 0, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.rule, func(t *testing.T) {
+			rule, err := parsePriorityRule(tc.rule, GlobModeDoublestar)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error for rule %s", tc.rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePriorityRule(%s) error: %v", tc.rule, err)
+			}
+			if rule.weight != tc.weight {
+				t.Errorf("weight = %d, want %d", rule.weight, tc.weight)
+			}
+			if !rule.matcher.Match(tc.match) {
+				t.Errorf("rule %s does not match %s", tc.rule, tc.match)
+			}
+		})
+	}
+}
+
+// TestRankFiles tests ordering by priority score and tie-breakers
+func TestRankFiles(t *testing.T) {
+	now := time.Now()
+	newFiles := func() []*budgetFile {
+		return []*budgetFile{
+			{relPath: "a/deep/big.go", content: []byte("0123456789"), modTime: now.Add(-time.Hour)},
+			{relPath: "a/small.go", content: []byte("0"), modTime: now.Add(-2 * time.Hour)},
+			{relPath: "main.go", content: []byte("01234"), modTime: now},
+			{relPath: "z.go", content: []byte("01234"), modTime: now.Add(-3 * time.Hour), score: 1},
+		}
+	}
+	paths := func(files []*budgetFile) []string {
+		var result []string
+		for _, f := range files {
+			result = append(result, f.relPath)
+		}
+		return result
+	}
+
+	testCases := []struct {
+		name     string
+		rankBy   []string
+		expected []string
+	}{
+		{"default", nil, []string{"z.go", "main.go", "a/small.go", "a/deep/big.go"}},
+		{"recency", []string{RankByRecency}, []string{"z.go", "main.go", "a/deep/big.go", "a/small.go"}},
+		{"size then depth", []string{RankBySize, RankByDepth}, []string{"z.go", "a/small.go", "main.go", "a/deep/big.go"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := newFiles()
+			rankFiles(files, tc.rankBy)
+			if result := paths(files); !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("rankFiles() = %v, want %v", result, tc.expected)
+			}
+		})
+	}
+
+	if err := validateRankBy([]string{"size", "name"}); err == nil {
+		t.Error("Expected error for unknown rank criterion")
+	}
+}
+
+// TestOutline tests extraction of declaration lines
+func TestOutline(t *testing.T) {
+	content := []byte("package main\n\nimport \"fmt\"\n\n// Greet says hello\nfunc Greet() {\n\tfmt.Println(\"hi\")\n}\n\ntype T struct{}\n")
+	lines, total := outline(content)
+
+	expected := []string{"package main", "func Greet() {", "type T struct{}"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("outline() = %q, want %q", lines, expected)
+	}
+	if total != 10 {
+		t.Errorf("total lines = %d, want 10", total)
+	}
+
+	if lines, _ := outline([]byte("# Title\ntext\n## Section\nmore text\n")); len(lines) != 2 {
+		t.Errorf("Expected Markdown headings in outline, got %q", lines)
+	}
+}
+
+// TestBuildBudgetPlan tests how files are degraded to fit the budget
+func TestBuildBudgetPlan(t *testing.T) {
+	body := strings.Repeat("word ", 40)
+	code := "func A() {\n" + body + "\n}\nfunc B() {\n" + body + "\n}\n"
+
+	newFiles := func() []*budgetFile {
+		return []*budgetFile{
+			{relPath: "first.go", content: []byte(code)},
+			{relPath: "second.go", content: []byte(code)},
+			{relPath: "notes.txt", content: []byte(body)},
+		}
+	}
+
+	codeTokens, _ := entryTokens(namedFormatter(FormatText), newEntry("first.go", []byte(code)), false, countWords)
+
+	testCases := []struct {
+		name     string
+		budget   int
+		fixed    int
+		expected map[string]string
+	}{
+		{
+			name:   "everything fits",
+			budget: 1000,
+			expected: map[string]string{
+				"first.go": entryFull, "second.go": entryFull, "notes.txt": entryFull,
+			},
+		},
+		{
+			name:   "lower ranked files degrade",
+			budget: codeTokens + 40,
+			expected: map[string]string{
+				"first.go": entryFull, "second.go": entryOutline, "notes.txt": entryPathOnly,
+			},
+		},
+		{
+			name:   "lowest ranked files are dropped",
+			budget: 40,
+			fixed:  10,
+			expected: map[string]string{
+				"first.go": entryPathOnly, "second.go": entryPathOnly, "notes.txt": entryDropped,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := buildBudgetPlan(newFiles(), tc.budget, tc.fixed, namedFormatter(FormatText), countWords)
+			if err != nil {
+				t.Fatalf("buildBudgetPlan() error: %v", err)
+			}
+
+			for relPath, mode := range tc.expected {
+				entry := plan.entries[relPath]
+				if entry.mode != mode {
+					t.Errorf("%s: mode = %s, want %s", relPath, entry.mode, mode)
+				}
+				if mode != entryFull && entry.reason == "" {
+					t.Errorf("%s: expected a reason for mode %s", relPath, mode)
+				}
+			}
+
+			if used := plan.used(); used > tc.budget {
+				t.Errorf("plan uses %d tokens, budget is %d", used, tc.budget)
+			}
+
+			var report bytes.Buffer
+			plan.report(&report)
+			for relPath, mode := range tc.expected {
+				if mode != entryFull && !strings.Contains(report.String(), relPath) {
+					t.Errorf("Report does not mention %s:\n%s", relPath, report.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cacheVersion is increased whenever the meaning of cached values changes
+const cacheVersion = 3
+
+// cacheExpiry is how long entries that are not used any more are kept
+const cacheExpiry = 30 * 24 * time.Hour
+
+// minCachedText is the length below which counting tokens is cheaper than caching them
+const minCachedText = 1024
+
+// recentWindow is how close to a scan a modification time is considered recent: an
+// edit of the same size within it may not change the modification time
+const recentWindow = time.Second
+
+// cachedFile is the metadata of a file, valid as long as its size and modification
+// time do not change. For files modified shortly before they were checked, the hash
+// of the content must match as well.
+type cachedFile struct {
+	Size     int64          `json:"size"`
+	ModTime  int64          `json:"mtime"`
+	Checked  int64          `json:"checked"`        // When the entry was recorded or last verified, in nanoseconds
+	Hash     string         `json:"hash,omitempty"` // Hash of the content, recorded while the modification time is recent
+	Text     *bool          `json:"text,omitempty"` // Whether the file is a text file, nil if not detected yet
+	Language string         `json:"language,omitempty"`
+	Measured bool           `json:"measured,omitempty"`
+	Lines    int            `json:"lines,omitempty"`
+	Tokens   map[string]int `json:"tokens,omitempty"` // Tokens keyed by tokenizer, and format for rendered entries
+	Used     int64          `json:"used"`             // Day the entry was last used, in days since the epoch
+}
+
+// recent reports whether the file was modified too shortly before it was checked to
+// trust its modification time
+func (f *cachedFile) recent() bool {
+	return f.ModTime > f.Checked-int64(recentWindow)
+}
+
+// fileMeasure is what the cache knows about the content of a file
+type fileMeasure struct {
+	Language string
+	Lines    int
+	Tokens   int
+}
+
+// fileHash returns the content hash of a file, which the cache only asks for when it
+// cannot trust the modification time
+type fileHash func() (string, error)
+
+// cachedTokens is the token count of a text
+type cachedTokens struct {
+	Tokens int   `json:"tokens"`
+	Used   int64 `json:"used"`
+}
+
+// fileCache persists file metadata and token counts of a scanned directory between
+// runs. Metadata is keyed by the relative path, size and modification time, so
+// unchanged files are not read, and by the content hash for recently modified files.
+// Token counts are keyed by the tokenizer and a hash of the counted text, which
+// covers files as well as the rendered entries and output segments. It is safe for
+// concurrent use.
+type fileCache struct {
+	path  string
+	today int64
+
+	mu      sync.Mutex
+	Version int                      `json:"version"`
+	Files   map[string]*cachedFile   `json:"files"`
+	Tokens  map[string]*cachedTokens `json:"tokens"`
+	dirty   bool
+}
+
+// DefaultCacheDir returns the directory of the cache below the user cache directory
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "dir2prompt"), nil
+}
+
+// ClearCache removes the cache directory and everything in it
+func ClearCache(cacheDir string) error {
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return nil
+}
+
+// loadCache opens the cache of a scanned directory. A missing, unreadable or outdated
+// cache file starts an empty cache.
+func loadCache(cacheDir, dirPath string) *fileCache {
+	abs, err := filepath.Abs(dirPath)
+	if err != nil {
+		abs = dirPath
+	}
+	sum := sha256.Sum256([]byte(abs))
+
+	c := &fileCache{
+		path:  filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+".json"),
+		today: time.Now().Unix() / 86400,
+	}
+	if data, err := os.ReadFile(c.path); err == nil {
+		if err := json.Unmarshal(data, c); err != nil || c.Version != cacheVersion {
+			c.Files, c.Tokens = nil, nil
+		}
+	}
+	c.Version = cacheVersion
+	if c.Files == nil {
+		c.Files = make(map[string]*cachedFile)
+	}
+	if c.Tokens == nil {
+		c.Tokens = make(map[string]*cachedTokens)
+	}
+	return c
+}
+
+// save writes the cache if it changed, dropping entries that expired
+func (c *fileCache) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	oldest := c.today - int64(cacheExpiry/(24*time.Hour))
+	for key, f := range c.Files {
+		if f.Used < oldest {
+			delete(c.Files, key)
+		}
+	}
+	for key, t := range c.Tokens {
+		if t.Used < oldest {
+			delete(c.Tokens, key)
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Replace the file atomically so concurrent runs never read a partial cache
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".cache-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// contentHash returns the hash file metadata is keyed by
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:16])
+}
+
+// hashOf returns the fileHash of content that was already read
+func hashOf(content []byte) fileHash {
+	return func() (string, error) {
+		return contentHash(content), nil
+	}
+}
+
+// hashFile returns the fileHash of the file at path, reading it when asked
+func hashFile(path string) fileHash {
+	return func() (string, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		return contentHash(content), nil
+	}
+}
+
+// file returns the metadata of a file, replacing entries of an older version of the
+// file. The content is only hashed while the modification time is recent. The caller
+// must hold the lock.
+func (c *fileCache) file(relPath string, info os.FileInfo, hash fileHash) (*cachedFile, error) {
+	now := time.Now().UnixNano()
+	f, ok := c.Files[relPath]
+	valid := ok && f.Size == info.Size() && f.ModTime == info.ModTime().UnixNano()
+
+	var sum string
+	if valid && f.recent() {
+		var err error
+		if sum, err = hash(); err != nil {
+			return nil, err
+		}
+		if valid = f.Hash != "" && f.Hash == sum; valid {
+			f.Checked = now
+			c.dirty = true
+		}
+	}
+	if !valid {
+		f = &cachedFile{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Checked: now}
+		c.Files[relPath] = f
+		c.dirty = true
+	}
+	if f.recent() && f.Hash == "" {
+		if sum == "" {
+			var err error
+			if sum, err = hash(); err != nil {
+				return nil, err
+			}
+		}
+		f.Hash = sum
+	}
+
+	if f.Used != c.today {
+		f.Used = c.today
+		c.dirty = true
+	}
+	return f, nil
+}
+
+// isText returns whether a file is a text file, detecting it with detect unless the
+// cache knows the file
+func (c *fileCache) isText(relPath string, info os.FileInfo, hash fileHash, detect func() (bool, error)) (bool, error) {
+	c.mu.Lock()
+	f, err := c.file(relPath, info, hash)
+	if err != nil {
+		c.mu.Unlock()
+		return false, err
+	}
+	if f.Text != nil {
+		c.mu.Unlock()
+		return *f.Text, nil
+	}
+	c.mu.Unlock()
+
+	text, err := detect()
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, err = c.file(relPath, info, hash); err != nil {
+		return false, err
+	}
+	f.Text, f.Language = &text, languageOf(relPath)
+	c.dirty = true
+	return text, nil
+}
+
+// measured returns the cached language, lines and tokens of a file, ok only if the
+// tokens of key are known or not needed. The key is the tokenizer for the tokens of
+// the content, and names the format as well for the tokens of a rendered entry.
+func (c *fileCache) measured(relPath string, info os.FileInfo, hash fileHash, key string) (fileMeasure, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.file(relPath, info, hash)
+	if err != nil || !f.Measured {
+		return fileMeasure{}, false, err
+	}
+	m := fileMeasure{Language: f.Language, Lines: f.Lines}
+	if key == "" {
+		return m, true, nil
+	}
+	tokens, ok := f.Tokens[key]
+	m.Tokens = tokens
+	return m, ok, nil
+}
+
+// setMeasured stores the lines of a file and its tokens unless key is empty
+func (c *fileCache) setMeasured(relPath string, info os.FileInfo, hash fileHash, key string, m fileMeasure) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.file(relPath, info, hash)
+	if err != nil {
+		return err
+	}
+	f.Measured, f.Language, f.Lines = true, m.Language, m.Lines
+	if key != "" {
+		if f.Tokens == nil {
+			f.Tokens = make(map[string]int)
+		}
+		f.Tokens[key] = m.Tokens
+	}
+	c.dirty = true
+	return nil
+}
+
+// tokens returns the tokens of a text, counting them with count unless the cache
+// knows the text. Short texts are always counted.
+func (c *fileCache) tokens(tokenizer, text string, count func(string) int) int {
+	if c == nil || len(text) < minCachedText {
+		return count(text)
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	key := tokenizer + ":" + hex.EncodeToString(sum[:16])
+
+	c.mu.Lock()
+	if t, ok := c.Tokens[key]; ok {
+		if t.Used != c.today {
+			t.Used = c.today
+			c.dirty = true
+		}
+		c.mu.Unlock()
+		return t.Tokens
+	}
+	c.mu.Unlock()
+
+	n := count(text)
+
+	c.mu.Lock()
+	c.Tokens[key] = &cachedTokens{Tokens: n, Used: c.today}
+	c.dirty = true
+	c.mu.Unlock()
+	return n
+}
+
+// cacheStat returns the info of a file the metadata cache applies to, or nil if the
+// cache is disabled or the files are read from a revision
+func (p *Processor) cacheStat(path string) (os.FileInfo, error) {
+	if p.cache == nil || p.revisionFiles != nil {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return info, nil
+}
@@ -0,0 +1,297 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCacheTokens tests that token counts are reused for the same text and tokenizer
+func TestCacheTokens(t *testing.T) {
+	c := loadCache(t.TempDir(), "project")
+	calls := 0
+	count := func(text string) int {
+		calls++
+		return countWordTokens(text)
+	}
+
+	long := strings.Repeat("word ", minCachedText)
+	tests := []struct {
+		name      string
+		tokenizer string
+		text      string
+		calls     int
+	}{
+		{"first count", TokenizerWords, long, 1},
+		{"cached", TokenizerWords, long, 1},
+		{"other tokenizer", TokenizerCL100K, long, 2},
+		{"other text", TokenizerWords, long + "more", 3},
+		{"short text", TokenizerWords, "short", 4},
+		{"short text again", TokenizerWords, "short", 5},
+	}
+
+	for _, test := range tests {
+		if got := c.tokens(test.tokenizer, test.text, count); got != countWordTokens(test.text) {
+			t.Errorf("%s: tokens = %d, want %d", test.name, got, countWordTokens(test.text))
+		}
+		if calls != test.calls {
+			t.Errorf("%s: counted %d times, want %d", test.name, calls, test.calls)
+		}
+	}
+
+	var nilCache *fileCache
+	if got := nilCache.tokens(TokenizerWords, long, count); got != countWordTokens(long) {
+		t.Errorf("Disabled cache returned %d tokens", got)
+	}
+}
+
+// TestCacheFiles tests that file metadata is valid for the same size and modification
+// time, and for the same content hash while the modification time is recent
+func TestCacheFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "data.xyz")
+	write := func(content string, modTime time.Time) os.FileInfo {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		return info
+	}
+	hashes := 0
+	hash := func() (string, error) {
+		hashes++
+		return hashFile(path)()
+	}
+
+	c := loadCache(t.TempDir(), tempDir)
+	detections := 0
+	detect := func() (bool, error) {
+		detections++
+		return isTextFile(path)
+	}
+
+	// An old file is trusted by size and modification time without reading it
+	old := time.Now().Add(-time.Hour)
+	info := write("plain text", old)
+	for i := 0; i < 2; i++ {
+		if text, err := c.isText("data.xyz", info, hash, detect); err != nil || !text {
+			t.Fatalf("isText = %v, %v, want true", text, err)
+		}
+	}
+	if detections != 1 || hashes != 0 {
+		t.Errorf("Detected %d times and hashed %d times, want 1 and 0", detections, hashes)
+	}
+	if c.Files["data.xyz"].Hash != "" {
+		t.Error("Expected no content hash for an old file")
+	}
+
+	if _, ok, err := c.measured("data.xyz", info, hash, ""); ok || err != nil {
+		t.Errorf("Expected an unmeasured file, got %v, %v", ok, err)
+	}
+	if err := c.setMeasured("data.xyz", info, hash, TokenizerWords, fileMeasure{Lines: 1, Tokens: 2}); err != nil {
+		t.Fatalf("setMeasured error: %v", err)
+	}
+	if m, ok, err := c.measured("data.xyz", info, hash, TokenizerWords); !ok || err != nil || m.Lines != 1 || m.Tokens != 2 {
+		t.Errorf("measured = %+v, %v, %v, want 1 line and 2 tokens", m, ok, err)
+	}
+	if _, ok, _ := c.measured("data.xyz", info, hash, TokenizerChars); ok {
+		t.Error("Expected no tokens for another tokenizer")
+	}
+
+	// A changed size is detected again
+	info = write("\x00\x01", old)
+	if text, err := c.isText("data.xyz", info, hash, detect); err != nil || text {
+		t.Errorf("isText = %v, %v after the change, want false", text, err)
+	}
+
+	// A recent file is hashed, so an edit that keeps size and modification time is
+	// noticed
+	recent := time.Now()
+	info = write("plain text", recent)
+	if text, err := c.isText("data.xyz", info, hash, detect); err != nil || !text {
+		t.Fatalf("isText = %v, %v, want true", text, err)
+	}
+	info = write("\x00ain text", recent)
+	if text, err := c.isText("data.xyz", info, hash, detect); err != nil || text {
+		t.Errorf("isText = %v, %v after an edit of the same size, want false", text, err)
+	}
+	if hashes == 0 {
+		t.Error("Expected the recent file to be hashed")
+	}
+}
+
+// TestCacheSave tests that the cache survives a reload, drops expired entries and
+// ignores unreadable cache files
+func TestCacheSave(t *testing.T) {
+	cacheDir := t.TempDir()
+	long := strings.Repeat("word ", minCachedText)
+
+	c := loadCache(cacheDir, "project")
+	c.tokens(TokenizerWords, long, countWordTokens)
+	c.tokens(TokenizerChars, long, countCharTokens)
+	for key, entry := range c.Tokens {
+		if strings.HasPrefix(key, TokenizerChars+":") {
+			entry.Used -= 31
+		}
+	}
+	if err := c.save(); err != nil {
+		t.Fatalf("save error: %v", err)
+	}
+
+	c = loadCache(cacheDir, "project")
+	if len(c.Tokens) != 1 {
+		t.Errorf("Expected the expired entry to be dropped, got %d entries", len(c.Tokens))
+	}
+	calls := 0
+	c.tokens(TokenizerWords, long, func(text string) int {
+		calls++
+		return countWordTokens(text)
+	})
+	if calls != 0 {
+		t.Error("Expected the token count to be loaded from disk")
+	}
+	if other := loadCache(cacheDir, "other"); len(other.Tokens) != 0 {
+		t.Error("Expected a separate cache for another directory")
+	}
+
+	if err := os.WriteFile(c.path, []byte("{broken"), 0644); err != nil {
+		t.Fatalf("Failed to write cache: %v", err)
+	}
+	if c = loadCache(cacheDir, "project"); len(c.Tokens) != 0 || c.Files == nil {
+		t.Errorf("Expected an empty cache for a broken cache file, got %+v", c)
+	}
+}
+
+// TestProcessWithCache tests that warm runs give the same output and report and
+// notice changed files
+func TestProcessWithCache(t *testing.T) {
+	tempDir := setupReportDir(t)
+	if err := os.WriteFile(filepath.Join(tempDir, "notes.xyz"), []byte(strings.Repeat("note\n", 300)), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	config := Config{
+		DirPath:        tempDir,
+		IncludeFiles:   []string{"**"},
+		Output:         "-",
+		EstimateTokens: true,
+		Tokenizer:      TokenizerWords,
+		Report:         ReportTable,
+		TreeAnnotate:   []string{AnnotateLines, AnnotateTokens},
+		CacheDir:       t.TempDir(),
+	}
+
+	stdout, stderr := runProcess(t, config)
+	uncached := config
+	uncached.CacheDir = ""
+	if expected, expectedErr := runProcess(t, uncached); stdout != expected || stderr != expectedErr {
+		t.Fatalf("Cold run differs from an uncached run:\n%s\n%s", stdout, stderr)
+	}
+	entries, err := os.ReadDir(config.CacheDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected one cache file, got %v, %v", entries, err)
+	}
+	var reported bool
+	for key := range loadCache(config.CacheDir, tempDir).Files["pkg/a/big.go"].Tokens {
+		reported = reported || strings.HasPrefix(key, TokenizerWords+":")
+	}
+	if !reported {
+		t.Error("Expected the tokens of the report entry in the cache")
+	}
+
+	if warm, warmErr := runProcess(t, config); warm != stdout || warmErr != stderr {
+		t.Errorf("Warm run differs:\n%s\n%s", warm, warmErr)
+	}
+
+	// An edit that keeps the size and modification time is measured again
+	mid := filepath.Join(tempDir, "pkg", "a", "mid.go")
+	info, err := os.Stat(mid)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if err := os.WriteFile(mid, []byte(strings.Repeat("var mid = 1 ", 9)+"var mid = 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(mid, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	expected, expectedErr := runProcess(t, uncached)
+	if warm, warmErr := runProcess(t, config); warm != expected || warmErr != expectedErr {
+		t.Errorf("Run after an edit differs from an uncached run:\n%s\n%s", warm, warmErr)
+	}
+
+	// Replace the unknown file with a binary one of a different size
+	if err := os.WriteFile(filepath.Join(tempDir, "notes.xyz"), []byte{0x00, 0xFF}, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	stdout, stderr = runProcess(t, config)
+	if strings.Contains(stdout, "notes.xyz") || !strings.Contains(stderr, "Skipping binary file: notes.xyz") {
+		t.Errorf("Expected the changed file to be detected as binary:\n%s\n%s", stdout, stderr)
+	}
+}
+
+// TestReportSkipsUnchangedFiles tests that a warm report takes unchanged files from the
+// cache without reading them
+func TestReportSkipsUnchangedFiles(t *testing.T) {
+	tempDir := setupReportDir(t)
+	old := time.Now().Add(-time.Hour)
+	mid := filepath.Join(tempDir, "pkg", "a", "mid.go")
+	if err := os.Chtimes(mid, old, old); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	cacheDir := t.TempDir()
+
+	report := func() reportRow {
+		t.Helper()
+		p, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"**"}, Tokenizer: TokenizerWords})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		if p.formatter, err = p.newFormatter(); err != nil {
+			t.Fatalf("Failed to create formatter: %v", err)
+		}
+		p.cache = loadCache(cacheDir, tempDir)
+		matchedFiles, err := p.collectFiles()
+		if err != nil {
+			t.Fatalf("collectFiles error: %v", err)
+		}
+		report, err := p.buildReport(matchedFiles, nil)
+		if err != nil {
+			t.Fatalf("buildReport error: %v", err)
+		}
+		if err := p.cache.save(); err != nil {
+			t.Fatalf("save error: %v", err)
+		}
+		for _, row := range report.Files {
+			if row.Path == "pkg/a/mid.go" {
+				return row
+			}
+		}
+		t.Fatalf("No row for pkg/a/mid.go in %+v", report.Files)
+		return reportRow{}
+	}
+
+	cold := report()
+	if cold.Lines != 10 || cold.Language != "go" {
+		t.Fatalf("Unexpected row %+v", cold)
+	}
+
+	// Had the warm run read the file, it would see a single line
+	if err := os.WriteFile(mid, []byte(strings.Repeat("var mid = 1 ", 9)+"var mid = 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chtimes(mid, old, old); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	if warm := report(); warm != cold {
+		t.Errorf("Expected the cached row %+v, got %+v", cold, warm)
+	}
+}
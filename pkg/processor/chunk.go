@@ -0,0 +1,258 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// section is a file entry or the git diff placed into a chunk. A section that does not
+// fit into a single chunk is split into parts on line boundaries.
+type section struct {
+	entry Entry
+	diff  bool
+}
+
+// label returns the line listing the section in a chunk header
+func (s section) label() string {
+	label := s.entry.Path
+	if s.diff {
+		label = "Git Diff: " + label
+	}
+	if s.entry.Part > 0 {
+		label += fmt.Sprintf(" (part %d of %d)", s.entry.Part, s.entry.Parts)
+	}
+	return label
+}
+
+// chunkPath derives the name of a chunk file from the output path, e.g. output.txt
+// becomes output.001.txt
+func chunkPath(output string, index int) string {
+	ext := filepath.Ext(output)
+	return fmt.Sprintf("%s.%03d%s", strings.TrimSuffix(output, ext), index, ext)
+}
+
+// splitSection splits a section on line boundaries into parts whose content fits into
+// maxTokens. A single line longer than maxTokens becomes a part of its own.
+func splitSection(s section, maxTokens int, count func(string) (int, error)) ([]section, error) {
+	lines := strings.SplitAfter(s.entry.Content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var parts []section
+	var current strings.Builder
+	currentTokens, firstLine := 0, 1
+	flush := func(lastLine int) {
+		part := s
+		part.entry.Content = current.String()
+		part.entry.FirstLine = firstLine
+		part.entry.LastLine = lastLine
+		parts = append(parts, part)
+		current.Reset()
+		currentTokens, firstLine = 0, lastLine+1
+	}
+
+	for i, line := range lines {
+		tokens, err := count(line)
+		if err != nil {
+			return nil, err
+		}
+		if current.Len() > 0 && currentTokens+tokens > maxTokens {
+			flush(i)
+		}
+		current.WriteString(line)
+		currentTokens += tokens
+	}
+	if current.Len() > 0 || len(parts) == 0 {
+		flush(len(lines))
+	}
+
+	for i := range parts {
+		parts[i].entry.Part = i + 1
+		parts[i].entry.Parts = len(parts)
+	}
+	return parts, nil
+}
+
+// packChunks distributes the sections over as few chunks as possible, in order, so
+// that each chunk including its header and directory structure stays within the limit.
+// Sections are only split when they do not fit into an empty chunk.
+func packChunks(sections []section, limit int, doc Document, newFormatter formatterFactory, count func(string) (int, error)) ([][]section, error) {
+	documentTokens := func(doc Document) (int, error) {
+		rendered, err := renderDocument(newFormatter, doc, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		return count(rendered)
+	}
+
+	// Reserve room for chunk numbers up to 999 in the header
+	doc.Chunk, doc.Chunks, doc.Contents = 999, 999, nil
+	baseTokens, err := documentTokens(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header listing is measured without the tree to keep it cheap
+	listing := doc
+	listing.Tree = ""
+	listingTokens, err := documentTokens(listing)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := func(s section) (int, error) {
+		tokens, err := entryTokens(newFormatter, s.entry, s.diff, count)
+		if err != nil {
+			return 0, err
+		}
+		listed := listing
+		listed.Contents = []string{s.label()}
+		listedTokens, err := documentTokens(listed)
+		return tokens + listedTokens - listingTokens, err
+	}
+
+	var chunks [][]section
+	var current []section
+	used := baseTokens
+	for _, s := range sections {
+		tokens, err := cost(s)
+		if err != nil {
+			return nil, err
+		}
+
+		pieces := []section{s}
+		if baseTokens+tokens > limit {
+			// Measure the overhead of a part header with the widest numbers
+			probe := s
+			probe.entry.Content = ""
+			probe.entry.Part, probe.entry.Parts, probe.entry.FirstLine, probe.entry.LastLine = 99, 99, 99999, 99999
+			overhead, err := cost(probe)
+			if err != nil {
+				return nil, err
+			}
+			maxTokens := limit - baseTokens - overhead
+			if maxTokens <= 0 {
+				return nil, fmt.Errorf("chunk size of %d tokens is too small to hold the chunk header of %s", limit, s.entry.Path)
+			}
+			if pieces, err = splitSection(s, maxTokens, count); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, piece := range pieces {
+			if tokens, err = cost(piece); err != nil {
+				return nil, err
+			}
+			if len(current) > 0 && used+tokens > limit {
+				chunks = append(chunks, current)
+				current, used = nil, baseTokens
+			}
+			if baseTokens+tokens > limit {
+				fmt.Fprintf(os.Stderr, "Warning: %s contains a line longer than the chunk size\n", piece.entry.Path)
+			}
+			current = append(current, piece)
+			used += tokens
+		}
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+
+	return chunks, nil
+}
+
+// writeChunks splits the output into numbered files next to the output path. Each
+// chunk starts with a header listing its contents and repeats the directory structure
+// unless the structure takes more than a quarter of the chunk size. It returns the
+// total tokens of the chunks.
+func (p *Processor) writeChunks(matchedFiles []string, doc Document, diffEntry *Entry, plan *budgetPlan) (int, error) {
+	var sections []section
+	if plan != nil {
+		for _, relPath := range matchedFiles {
+			if entry, ok := plan.entry(relPath); ok {
+				sections = append(sections, section{entry: entry})
+			}
+		}
+	} else if err := p.readFiles(matchedFiles, func(relPath string, content []byte) error {
+		sections = append(sections, section{entry: newEntry(relPath, content)})
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if diffEntry != nil {
+		sections = append(sections, section{entry: *diffEntry, diff: true})
+	}
+
+	treeTokens, err := p.estimateTokens(doc.Tree)
+	if err != nil {
+		return 0, err
+	}
+	if treeTokens > p.config.ChunkTokens/4 {
+		doc.Tree, doc.Nodes = "", nil
+	}
+
+	chunks, err := packChunks(sections, p.config.ChunkTokens, doc, p.newFormatter, p.estimateTokens)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for i, chunk := range chunks {
+		chunkDoc := doc
+		chunkDoc.Chunk, chunkDoc.Chunks = i+1, len(chunks)
+		for _, s := range chunk {
+			chunkDoc.Contents = append(chunkDoc.Contents, s.label())
+		}
+
+		var entries []Entry
+		var diff *Entry
+		for _, s := range chunk {
+			if s.diff {
+				e := s.entry
+				diff = &e
+			} else {
+				entries = append(entries, s.entry)
+			}
+		}
+		rendered, err := renderDocument(p.newFormatter, chunkDoc, entries, diff)
+		if err != nil {
+			return 0, err
+		}
+
+		path := chunkPath(p.config.Output, i+1)
+		if err := os.WriteFile(path, []byte(rendered), 0644); err != nil {
+			return 0, fmt.Errorf("failed to write chunk file: %w", err)
+		}
+
+		tokens, err := p.estimateTokens(rendered)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s (%d tokens)\n", path, tokens)
+		total += tokens
+	}
+
+	if err := removeStaleChunks(p.config.Output, len(chunks)+1); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// removeStaleChunks removes the chunk files numbered from index on that an earlier run
+// with more chunks left behind
+func removeStaleChunks(output string, index int) error {
+	for ; ; index++ {
+		path := chunkPath(output, index)
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove stale chunk file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Removed stale %s\n", path)
+	}
+}
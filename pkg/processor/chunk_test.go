@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestChunkPath tests the naming of chunk files
+func TestChunkPath(t *testing.T) {
+	testCases := []struct {
+		output   string
+		index    int
+		expected string
+	}{
+		{"output.txt", 1, "output.001.txt"},
+		{"/tmp/prompt.md", 12, "/tmp/prompt.012.md"},
+		{"prompt", 3, "prompt.003"},
+	}
+
+	for _, tc := range testCases {
+		if result := chunkPath(tc.output, tc.index); result != tc.expected {
+			t.Errorf("chunkPath(%s, %d) = %s, want %s", tc.output, tc.index, result, tc.expected)
+		}
+	}
+}
+
+// TestSplitSection tests splitting a section on line boundaries
+func TestSplitSection(t *testing.T) {
+	s := section{entry: newEntry("big.txt", []byte("a b\nc d\ne f\ng h\ni\n"))}
+
+	parts, err := splitSection(s, 4, countWords)
+	if err != nil {
+		t.Fatalf("splitSection() error: %v", err)
+	}
+
+	expected := []struct {
+		content     string
+		first, last int
+	}{
+		{"a b\nc d\n", 1, 2},
+		{"e f\ng h\n", 3, 4},
+		{"i\n", 5, 5},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("Expected %d parts, got %d", len(expected), len(parts))
+	}
+	for i, part := range parts {
+		e := part.entry
+		if e.Content != expected[i].content || e.FirstLine != expected[i].first || e.LastLine != expected[i].last {
+			t.Errorf("part %d = %q lines %d-%d, want %q lines %d-%d", i+1, e.Content, e.FirstLine, e.LastLine,
+				expected[i].content, expected[i].first, expected[i].last)
+		}
+		if e.Part != i+1 || e.Parts != 3 {
+			t.Errorf("part %d numbered %d of %d", i+1, e.Part, e.Parts)
+		}
+	}
+
+	if header, _ := renderDocument(namedFormatter(FormatText), Document{}, []Entry{parts[1].entry}, nil); !strings.HasPrefix(header, "---\nFile: big.txt\nPart: 2 of 3, lines 3-4\n---\n\n") {
+		t.Errorf("Unexpected continuation header: %q", header)
+	}
+}
+
+// TestPackChunks tests that sections are packed in order and only split when necessary
+func TestPackChunks(t *testing.T) {
+	small := func(name string) section {
+		return section{entry: newEntry(name, []byte("one two three\n"))}
+	}
+	big := section{entry: newEntry("big.txt", []byte(strings.Repeat("w w w w w\n", 20)))}
+
+	const limit = 60
+	doc := Document{Root: "root", Tree: "t1 t2 t3 t4 t5\n"}
+	sections := []section{small("a.txt"), small("b.txt"), big, small("c.txt")}
+	chunks, err := packChunks(sections, limit, doc, namedFormatter(FormatText), countWords)
+	if err != nil {
+		t.Fatalf("packChunks() error: %v", err)
+	}
+
+	if len(chunks) < 3 {
+		t.Fatalf("Expected the big file to be split over several chunks, got %d chunks", len(chunks))
+	}
+
+	var order []string
+	for i, chunk := range chunks {
+		chunkDoc := doc
+		chunkDoc.Chunk, chunkDoc.Chunks = i+1, len(chunks)
+		for _, s := range chunk {
+			chunkDoc.Contents = append(chunkDoc.Contents, s.label())
+		}
+		var entries []Entry
+		for _, s := range chunk {
+			entries = append(entries, s.entry)
+			if s.entry.Part == 0 && s.entry.Path == "big.txt" {
+				t.Errorf("big.txt was not split")
+			}
+			if s.entry.Part <= 1 {
+				order = append(order, s.entry.Path)
+			}
+		}
+		rendered, _ := renderDocument(namedFormatter(FormatText), chunkDoc, entries, nil)
+		if tokens, _ := countWords(rendered); tokens > limit {
+			t.Errorf("chunk %d has %d tokens, limit is %d", i+1, tokens, limit)
+		}
+	}
+
+	if strings.Join(order, ",") != "a.txt,b.txt,big.txt,c.txt" {
+		t.Errorf("Sections out of order: %v", order)
+	}
+	if len(chunks[0]) < 2 || chunks[0][0].entry.Path != "a.txt" || chunks[0][1].entry.Path != "b.txt" {
+		t.Errorf("Expected small files to share the first chunk")
+	}
+
+	if _, err := packChunks(sections, 10, doc, namedFormatter(FormatText), countWords); err == nil {
+		t.Error("Expected error for a chunk size smaller than the chunk header")
+	}
+}
+
+// TestChunkRequiresOutputFile tests that chunked output needs a file name to derive chunk names from
+func TestChunkRequiresOutputFile(t *testing.T) {
+	for _, output := range []string{"", "-"} {
+		if _, err := NewProcessor(Config{DirPath: ".", IncludeFiles: []string{"*"}, Output: output, ChunkTokens: 100}); err == nil {
+			t.Errorf("Expected error for chunked output to %q", output)
+		}
+	}
+
+	if _, err := NewProcessor(Config{DirPath: ".", IncludeFiles: []string{"*"}, Output: "out.txt", ChunkTokens: 100}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// TestChunksRemoveStaleFiles tests that re-chunking into fewer parts removes the chunk
+// files of the earlier run
+func TestChunksRemoveStaleFiles(t *testing.T) {
+	tempDir := setupReportDir(t)
+	output := filepath.Join(t.TempDir(), "prompt.txt")
+
+	run := func(chunkTokens int) []string {
+		runProcess(t, Config{DirPath: tempDir, IncludeFiles: []string{"**"}, Output: output, ChunkTokens: chunkTokens})
+		chunks, err := filepath.Glob(filepath.Join(filepath.Dir(output), "prompt.*.txt"))
+		if err != nil {
+			t.Fatalf("Glob error: %v", err)
+		}
+		return chunks
+	}
+
+	if chunks := run(150); len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %v", chunks)
+	}
+	chunks := run(100000)
+	if len(chunks) != 1 || chunks[0] != chunkPath(output, 1) {
+		t.Errorf("Expected only the first chunk after re-chunking, got %v", chunks)
+	}
+}
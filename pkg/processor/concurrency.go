@@ -0,0 +1,160 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// workers returns the number of goroutines working on files at once
+func (p *Processor) workers() int {
+	if p.config.Jobs > 0 {
+		return p.config.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+// jobs returns the number of files detected or read concurrently. Revisions are read
+// serially since go-git repositories are not safe for concurrent use.
+func (p *Processor) jobs() int {
+	if p.config.Rev != "" {
+		return 1
+	}
+	return p.workers()
+}
+
+// runOrdered calls work for the indexes 0 to n-1 on up to jobs goroutines, and done
+// for every index in order once its work has finished. Only about jobs items are in
+// flight or waiting for done at any time, which bounds the memory held by results.
+// It stops starting work at the first error returned by done and returns it.
+func runOrdered(n, jobs int, work func(i int), done func(i int) error) error {
+	if jobs <= 1 {
+		for i := 0; i < n; i++ {
+			work(i)
+			if err := done(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	pending := make(chan chan struct{}, jobs)
+	stop := make(chan struct{})
+	go func() {
+		defer close(pending)
+		for i := 0; i < n; i++ {
+			finished := make(chan struct{})
+			select {
+			case pending <- finished:
+			case <-stop:
+				return
+			}
+			go func(i int) {
+				work(i)
+				close(finished)
+			}(i)
+		}
+	}()
+
+	// Wait for every started item, even after an error, so no work outlives the call
+	var err error
+	i := 0
+	for finished := range pending {
+		<-finished
+		if err == nil {
+			if err = done(i); err != nil {
+				close(stop)
+			}
+		}
+		i++
+	}
+	return err
+}
+
+// readFiles reads files concurrently and passes their contents to fn in the given order
+func (p *Processor) readFiles(relPaths []string, fn func(relPath string, content []byte) error) error {
+	contents := make([][]byte, len(relPaths))
+	errs := make([]error, len(relPaths))
+
+	return runOrdered(len(relPaths), p.jobs(), func(i int) {
+		contents[i], errs[i] = p.readFile(filepath.Join(p.config.DirPath, relPaths[i]), relPaths[i])
+	}, func(i int) error {
+		content := contents[i]
+		contents[i] = nil // Release the content once it has been handled
+		if errs[i] != nil {
+			return fmt.Errorf("failed to read file %s: %w", relPaths[i], errs[i])
+		}
+		return fn(relPaths[i], content)
+	})
+}
+
+// detectText checks whether a file is a text file, using the cache of file metadata
+func (p *Processor) detectText(relPath, path string) (bool, error) {
+	info, err := p.cacheStat(path)
+	if err != nil {
+		return false, err
+	}
+	if info == nil {
+		return isTextFile(path)
+	}
+	return p.cache.isText(filepath.ToSlash(relPath), info, hashFile(path), func() (bool, error) {
+		return isTextFile(path)
+	})
+}
+
+// fileCheck is the result of checking a candidate file found by the directory walk
+type fileCheck struct {
+	text    bool // Whether the file is a text file
+	matches bool // Whether the content passes --contains and --not-contains
+	err     error
+}
+
+// checkFile detects whether a candidate file is a text file and applies the content filters
+func (p *Processor) checkFile(relPath string) fileCheck {
+	path := filepath.Join(p.config.DirPath, relPath)
+
+	isText, err := p.detectText(relPath, path)
+	if err != nil {
+		return fileCheck{err: fmt.Errorf("failed to check if file is text: %w", err)}
+	}
+	if !isText {
+		return fileCheck{}
+	}
+
+	// Check the content against --contains and --not-contains
+	if p.hasContentFilters() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fileCheck{err: fmt.Errorf("failed to read file %s: %w", relPath, err)}
+		}
+		return fileCheck{text: true, matches: p.matchesContent(content)}
+	}
+	return fileCheck{text: true, matches: true}
+}
+
+// checkFiles checks the candidate files concurrently and returns the matching text
+// files in the order of the candidates, warning about skipped binary files
+func (p *Processor) checkFiles(candidates []string) ([]string, error) {
+	checks := make([]fileCheck, len(candidates))
+	matchedFiles := []string{}
+
+	err := runOrdered(len(candidates), p.jobs(), func(i int) {
+		checks[i] = p.checkFile(candidates[i])
+	}, func(i int) error {
+		check := checks[i]
+		switch {
+		case check.err != nil:
+			return check.err
+		case !check.text:
+			fmt.Fprintf(os.Stderr, "Warning: Skipping binary file: %s\n", candidates[i])
+		case check.matches:
+			matchedFiles = append(matchedFiles, candidates[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matchedFiles, nil
+}
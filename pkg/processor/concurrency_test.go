@@ -0,0 +1,240 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRunOrdered tests that results are handled in order with bounded concurrency
+func TestRunOrdered(t *testing.T) {
+	const n, jobs = 200, 4
+	results := make([]int, n)
+	var running, maxRunning int32
+
+	var order []int
+	err := runOrdered(n, jobs, func(i int) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(n-i) * time.Microsecond)
+		results[i] = i * i
+		atomic.AddInt32(&running, -1)
+	}, func(i int) error {
+		if results[i] != i*i {
+			return fmt.Errorf("result %d not ready", i)
+		}
+		order = append(order, i)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("runOrdered error: %v", err)
+	}
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("Handled %d at position %d", got, i)
+		}
+	}
+	if len(order) != n {
+		t.Errorf("Handled %d of %d items", len(order), n)
+	}
+	if maxRunning > jobs+1 {
+		t.Errorf("Up to %d items ran at once, want at most %d", maxRunning, jobs+1)
+	}
+}
+
+// TestRunOrderedStopsOnError tests that no new work starts after an error
+func TestRunOrderedStopsOnError(t *testing.T) {
+	for _, jobs := range []int{1, 4} {
+		var started int32
+		failure := errors.New("failure")
+		err := runOrdered(1000, jobs, func(i int) {
+			atomic.AddInt32(&started, 1)
+		}, func(i int) error {
+			if i == 10 {
+				return failure
+			}
+			return nil
+		})
+		if !errors.Is(err, failure) {
+			t.Errorf("jobs=%d: expected the error of done, got %v", jobs, err)
+		}
+		if started > 10+int32(jobs)+2 {
+			t.Errorf("jobs=%d: %d items started after the error", jobs, started)
+		}
+	}
+}
+
+// TestCheckFilesDeterministic tests that concurrent checks keep the walk order and warnings
+func TestCheckFilesDeterministic(t *testing.T) {
+	tempDir := setupSyntheticTree(t, t.TempDir(), 300)
+
+	var expected []string
+	var expectedWarnings string
+	for _, jobs := range []int{1, 8} {
+		p, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"**"}, Contains: []string{"value"}, Jobs: jobs})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+
+		var files []string
+		warnings := captureStderr(t, func() {
+			files, err = p.collectFiles()
+		})
+		if err != nil {
+			t.Fatalf("collectFiles error: %v", err)
+		}
+		if jobs == 1 {
+			expected, expectedWarnings = files, warnings
+			if len(files) == 0 || !strings.Contains(warnings, "Skipping binary file") {
+				t.Fatalf("Unexpected synthetic tree: %d files, warnings %q", len(files), warnings)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("jobs=%d: files differ from the serial scan", jobs)
+		}
+		if warnings != expectedWarnings {
+			t.Errorf("jobs=%d: warnings differ from the serial scan:\n%s", jobs, warnings)
+		}
+	}
+}
+
+// setupSyntheticTree creates n files spread over nested directories: mostly source
+// files, some without the searched word, and a few binary files
+func setupSyntheticTree(tb testing.TB, dir string, n int) string {
+	tb.Helper()
+
+	for i := 0; i < n; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("pkg%d", i%10), fmt.Sprintf("mod%d", i%7))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			tb.Fatalf("Failed to create directory: %v", err)
+		}
+
+		name, content := fmt.Sprintf("file%d.go", i), []byte(strings.Repeat(fmt.Sprintf("var value%d = %d\n", i, i), 40))
+		switch {
+		case i%50 == 0:
+			name, content = fmt.Sprintf("blob%d.bin", i), []byte{0x00, 0x01, 0x02, 0xFF}
+		case i%5 == 0:
+			content = []byte("package other\n")
+		}
+		if err := os.WriteFile(filepath.Join(sub, name), content, 0644); err != nil {
+			tb.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	return dir
+}
+
+// captureStderr returns what fn writes to stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	oldStderr := os.Stderr
+	os.Stderr = w
+	done := make(chan string)
+	go func() {
+		var sb strings.Builder
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			sb.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		done <- sb.String()
+	}()
+
+	fn()
+	w.Close()
+	os.Stderr = oldStderr
+	return <-done
+}
+
+// silenceStderr discards the binary file warnings for the rest of a benchmark
+func silenceStderr(b *testing.B) {
+	b.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatalf("Failed to open %s: %v", os.DevNull, err)
+	}
+	oldStderr := os.Stderr
+	os.Stderr = devNull
+	b.Cleanup(func() {
+		os.Stderr = oldStderr
+		devNull.Close()
+	})
+}
+
+// benchmarkJobs are the worker counts compared by the benchmarks: serial, four
+// workers and one per CPU
+func benchmarkJobs() []int {
+	jobs := []int{1}
+	for _, n := range []int{4, runtime.NumCPU()} {
+		if n > jobs[len(jobs)-1] {
+			jobs = append(jobs, n)
+		}
+	}
+	return jobs
+}
+
+// BenchmarkCollectFiles measures scanning and text detection of a synthetic tree
+func BenchmarkCollectFiles(b *testing.B) {
+	dir := setupSyntheticTree(b, b.TempDir(), 5000)
+	silenceStderr(b)
+
+	for _, jobs := range benchmarkJobs() {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p, err := NewProcessor(Config{DirPath: dir, IncludeFiles: []string{"**"}, Jobs: jobs})
+				if err != nil {
+					b.Fatalf("Failed to create processor: %v", err)
+				}
+				if _, err := p.collectFiles(); err != nil {
+					b.Fatalf("collectFiles error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkProcess measures a complete run over a synthetic tree, written to a file
+func BenchmarkProcess(b *testing.B) {
+	dir := setupSyntheticTree(b, b.TempDir(), 5000)
+	output := filepath.Join(b.TempDir(), "output.txt")
+	silenceStderr(b)
+
+	for _, jobs := range benchmarkJobs() {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			var size int64
+			for i := 0; i < b.N; i++ {
+				p, err := NewProcessor(Config{DirPath: dir, IncludeFiles: []string{"**"}, Output: output, Jobs: jobs})
+				if err != nil {
+					b.Fatalf("Failed to create processor: %v", err)
+				}
+				if err := p.Process(); err != nil {
+					b.Fatalf("Process error: %v", err)
+				}
+				if info, err := os.Stat(output); err == nil {
+					size = info.Size()
+				}
+			}
+			b.SetBytes(size)
+		})
+	}
+}
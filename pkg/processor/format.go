@@ -0,0 +1,656 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Built-in output formats
+const (
+	FormatText     = "text"
+	FormatXML      = "xml"
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+	FormatJSONL    = "jsonl"
+)
+
+// Entry is a file, a part of a file, or the git diff written to the output
+type Entry struct {
+	Path      string // Relative path, or the description of the compared revisions for the git diff
+	Content   string
+	Language  string // Language derived from the file name, empty if unknown
+	Size      int    // Size of the complete file in bytes
+	Mode      string // How the file is represented: full, outline or path-only
+	Part      int    // 1-based part number when the file is split over several chunks, 0 otherwise
+	Parts     int
+	FirstLine int
+	LastLine  int
+}
+
+// Document describes the whole output, or a single chunk of it
+type Document struct {
+	Root     string      // Name of the scanned directory
+	Tree     string      // Rendered directory tree, empty when omitted
+	Nodes    []*TreeNode // Top-level nodes of the directory tree, nil when omitted
+	Chunk    int         // 1-based chunk number, 0 when the output is not split
+	Chunks   int         // Total number of chunks
+	Contents []string    // Labels of the entries contained in the chunk
+}
+
+// Formatter renders the output. Begin is called once, followed by File for every
+// entry, an optional Diff and finally End. Implementations may keep state between
+// calls, so a new Formatter is created for every document.
+type Formatter interface {
+	Begin(w io.Writer, doc Document) error
+	File(w io.Writer, e Entry) error
+	Diff(w io.Writer, e Entry) error
+	End(w io.Writer) error
+}
+
+// formatters contains the constructors of the built-in formats keyed by name
+var formatters = map[string]func() Formatter{
+	FormatText:     func() Formatter { return &textFormatter{} },
+	FormatXML:      func() Formatter { return &xmlFormatter{} },
+	FormatMarkdown: func() Formatter { return &markdownFormatter{} },
+	FormatJSON:     func() Formatter { return &jsonFormatter{} },
+	FormatJSONL:    func() Formatter { return &jsonlFormatter{} },
+}
+
+// FormatNames returns the sorted names of the built-in formats
+func FormatNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewFormatter returns a new formatter for the named format. An empty name selects
+// the plain text format.
+func NewFormatter(name string) (Formatter, error) {
+	if name == "" {
+		name = FormatText
+	}
+	newFormatter, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format '%s' (available: %s)", name, strings.Join(FormatNames(), ", "))
+	}
+	return newFormatter(), nil
+}
+
+// newEntry returns the entry of a complete file
+func newEntry(relPath string, content []byte) Entry {
+	relPath = filepath.ToSlash(relPath)
+	return Entry{
+		Path:     relPath,
+		Content:  string(content),
+		Language: languageOf(relPath),
+		Size:     len(content),
+		Mode:     entryFull,
+	}
+}
+
+// formatterFactory creates the formatter of an output document
+type formatterFactory func() (Formatter, error)
+
+// namedFormatter returns a factory for a built-in format
+func namedFormatter(name string) formatterFactory {
+	return func() (Formatter, error) {
+		return NewFormatter(name)
+	}
+}
+
+// renderDocument renders a complete document with a new formatter. The diff is
+// written after the entries if it is not nil.
+func renderDocument(newFormatter formatterFactory, doc Document, entries []Entry, diff *Entry) (string, error) {
+	f, err := newFormatter()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := f.Begin(&buf, doc); err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if err := f.File(&buf, e); err != nil {
+			return "", err
+		}
+	}
+	if diff != nil {
+		if err := f.Diff(&buf, *diff); err != nil {
+			return "", err
+		}
+	}
+	if err := f.End(&buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// entryTokens returns the number of tokens a file or diff entry adds to an empty
+// document. Measuring the difference keeps formats that only render in End, such as
+// templates, accurate.
+func entryTokens(newFormatter formatterFactory, e Entry, diff bool, count func(string) (int, error)) (int, error) {
+	empty, err := renderDocument(newFormatter, Document{}, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var with string
+	if diff {
+		with, err = renderDocument(newFormatter, Document{}, nil, &e)
+	} else {
+		with, err = renderDocument(newFormatter, Document{}, []Entry{e}, nil)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	emptyTokens, err := count(empty)
+	if err != nil {
+		return 0, err
+	}
+	withTokens, err := count(with)
+	if err != nil {
+		return 0, err
+	}
+	return withTokens - emptyTokens, nil
+}
+
+// partLabel describes the part of a split file, e.g. "part 2 of 3, lines 121-240"
+func partLabel(e Entry) string {
+	return fmt.Sprintf("part %d of %d, lines %d-%d", e.Part, e.Parts, e.FirstLine, e.LastLine)
+}
+
+// textFormatter writes the plain text format with "---" delimited headers. With a
+// boundary, which is declared once at the top, every section starts with a
+// "--boundary" line instead and the output ends with "--boundary--".
+type textFormatter struct {
+	boundary string
+}
+
+func (f *textFormatter) Begin(w io.Writer, doc Document) error {
+	var sb strings.Builder
+	if f.boundary != "" {
+		fmt.Fprintf(&sb, "Boundary: %s\n", f.boundary)
+		if doc.Chunk > 0 {
+			fmt.Fprintf(&sb, "Chunk: %d of %d\n", doc.Chunk, doc.Chunks)
+		}
+		sb.WriteString("\n")
+		if doc.Chunk > 0 {
+			sb.WriteString("Contents:\n")
+			for _, label := range doc.Contents {
+				fmt.Fprintf(&sb, "  %s\n", label)
+			}
+			sb.WriteString("\n")
+		}
+	} else if doc.Chunk > 0 {
+		fmt.Fprintf(&sb, "---\nChunk: %d of %d\n---\n\nContents:\n", doc.Chunk, doc.Chunks)
+		for _, label := range doc.Contents {
+			fmt.Fprintf(&sb, "  %s\n", label)
+		}
+		sb.WriteString("\n")
+	}
+	if doc.Tree != "" {
+		sb.WriteString("Directory Structure:\n\n")
+		sb.WriteString(doc.Tree)
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (f *textFormatter) File(w io.Writer, e Entry) error {
+	return f.section(w, "File", e, "\n\n")
+}
+
+func (f *textFormatter) Diff(w io.Writer, e Entry) error {
+	return f.section(w, "Git Diff", e, "\n")
+}
+
+func (f *textFormatter) End(w io.Writer) error {
+	if f.boundary == "" {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "--%s--\n", f.boundary); err != nil {
+		return fmt.Errorf("failed to write closing boundary: %w", err)
+	}
+	return nil
+}
+
+// section writes a delimited header, the content and the trailer. With a boundary the
+// trailer is a single newline, which belongs to the following boundary line.
+func (f *textFormatter) section(w io.Writer, label string, e Entry, trailer string) error {
+	delimiter := "---\n"
+	if f.boundary != "" {
+		delimiter = "--" + f.boundary + "\n"
+		trailer = "\n"
+	}
+
+	header := fmt.Sprintf("%s%s: %s\n", delimiter, label, e.Path)
+	if e.Part > 0 {
+		header += fmt.Sprintf("Part: %d of %d, lines %d-%d\n", e.Part, e.Parts, e.FirstLine, e.LastLine)
+	}
+	if f.boundary == "" {
+		header += "---\n"
+	}
+	header += "\n"
+
+	if _, err := io.WriteString(w, header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := io.WriteString(w, e.Content); err != nil {
+		return fmt.Errorf("failed to write content: %w", err)
+	}
+	if _, err := io.WriteString(w, trailer); err != nil {
+		return fmt.Errorf("failed to write newline: %w", err)
+	}
+	return nil
+}
+
+// xmlFormatter writes Anthropic-style <documents> XML. Contents are wrapped in CDATA
+// sections so code does not need to be escaped.
+type xmlFormatter struct {
+	index int
+}
+
+func (f *xmlFormatter) Begin(w io.Writer, doc Document) error {
+	var sb strings.Builder
+	if doc.Chunk > 0 {
+		fmt.Fprintf(&sb, "<documents chunk=\"%d\" chunks=\"%d\">\n", doc.Chunk, doc.Chunks)
+	} else {
+		sb.WriteString("<documents>\n")
+	}
+	if doc.Tree != "" {
+		fmt.Fprintf(&sb, "<directory_structure>\n%s</directory_structure>\n", xmlEscape(doc.Tree))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (f *xmlFormatter) File(w io.Writer, e Entry) error {
+	f.index++
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<document index=\"%d\"", f.index)
+	if e.Mode != "" && e.Mode != entryFull {
+		fmt.Fprintf(&sb, " mode=\"%s\"", e.Mode)
+	}
+	if e.Part > 0 {
+		fmt.Fprintf(&sb, " part=\"%d\" parts=\"%d\" lines=\"%d-%d\"", e.Part, e.Parts, e.FirstLine, e.LastLine)
+	}
+	fmt.Fprintf(&sb, ">\n<source>%s</source>\n", xmlEscape(e.Path))
+	attr, content := xmlContent(e.Content)
+	fmt.Fprintf(&sb, "<document_content%s>%s</document_content>\n</document>\n", attr, content)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (f *xmlFormatter) Diff(w io.Writer, e Entry) error {
+	attrs := fmt.Sprintf(" description=\"%s\"", xmlEscape(e.Path))
+	if e.Part > 0 {
+		attrs += fmt.Sprintf(" part=\"%d\" parts=\"%d\" lines=\"%d-%d\"", e.Part, e.Parts, e.FirstLine, e.LastLine)
+	}
+	attr, content := xmlContent(e.Content)
+	_, err := fmt.Fprintf(w, "<git_diff%s%s>%s</git_diff>\n", attrs, attr, content)
+	return err
+}
+
+func (f *xmlFormatter) End(w io.Writer) error {
+	_, err := io.WriteString(w, "</documents>\n")
+	return err
+}
+
+// xmlEscaper escapes text for use in XML character data and attribute values while
+// keeping line breaks intact
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+// xmlEscape escapes text for use in XML character data and attribute values
+func xmlEscape(s string) string {
+	return xmlEscaper.Replace(s)
+}
+
+// cdataEscaper splits any "]]>" in the text across two CDATA sections and writes
+// carriage returns as character references, since XML parsers normalize line endings
+var cdataEscaper = strings.NewReplacer("]]>", "]]]]><![CDATA[>", "\r", "]]>&#13;<![CDATA[")
+
+// cdata wraps text in a CDATA section
+func cdata(s string) string {
+	return "<![CDATA[" + cdataEscaper.Replace(s) + "]]>"
+}
+
+// xmlContent wraps text in a CDATA section, or encodes it as base64 with an
+// encoding attribute when it holds characters that XML 1.0 does not allow
+func xmlContent(s string) (attr, content string) {
+	if !isXMLText(s) {
+		return ` encoding="base64"`, base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	return "", cdata(s)
+}
+
+// isXMLText reports whether text is valid UTF-8 made only of characters allowed
+// in XML 1.0 documents
+func isXMLText(s string) bool {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return false
+			}
+		}
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+		case r < 0x20, r >= 0xD800 && r < 0xE000, r == 0xFFFE, r == 0xFFFF:
+			return false
+		}
+	}
+	return true
+}
+
+// markdownFormatter writes a heading per file followed by a fenced code block tagged
+// with the language of the file
+type markdownFormatter struct{}
+
+// noFinalNewline follows the code fence of a file that does not end with a newline,
+// since the fence itself always adds one
+const noFinalNewline = "<!-- no newline at end of file -->"
+
+func (f *markdownFormatter) Begin(w io.Writer, doc Document) error {
+	var sb strings.Builder
+	if doc.Chunk > 0 {
+		fmt.Fprintf(&sb, "# Chunk %d of %d\n\n", doc.Chunk, doc.Chunks)
+		for _, label := range doc.Contents {
+			fmt.Fprintf(&sb, "- %s\n", label)
+		}
+		sb.WriteString("\n")
+	}
+	if doc.Tree != "" {
+		sb.WriteString("## Directory Structure\n\n")
+		sb.WriteString(fenced(doc.Tree, "text"))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (f *markdownFormatter) File(w io.Writer, e Entry) error {
+	heading := e.Path
+	if e.Part > 0 {
+		heading += " (" + partLabel(e) + ")"
+	}
+	if e.Mode != "" && e.Mode != entryFull {
+		heading += " [" + e.Mode + "]"
+	}
+	block := fenced(e.Content, e.Language)
+	if e.Content != "" && !strings.HasSuffix(e.Content, "\n") {
+		block += noFinalNewline + "\n\n"
+	}
+	_, err := fmt.Fprintf(w, "## %s\n\n%s", heading, block)
+	return err
+}
+
+func (f *markdownFormatter) Diff(w io.Writer, e Entry) error {
+	heading := "Git Diff: " + e.Path
+	if e.Part > 0 {
+		heading += " (" + partLabel(e) + ")"
+	}
+	_, err := fmt.Fprintf(w, "## %s\n\n%s", heading, fenced(e.Content, "diff"))
+	return err
+}
+
+func (f *markdownFormatter) End(w io.Writer) error {
+	return nil
+}
+
+// fenced wraps content in a code fence that is longer than any backtick run inside it
+func fenced(content, language string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return fence + language + "\n" + content + fence + "\n\n"
+}
+
+// jsonFile is the JSON representation of a file entry
+type jsonFile struct {
+	Path      string `json:"path"`
+	Language  string `json:"language,omitempty"`
+	Size      int    `json:"size"`
+	Lines     int    `json:"lines"`
+	Mode      string `json:"mode,omitempty"`
+	Part      int    `json:"part,omitempty"`
+	Parts     int    `json:"parts,omitempty"`
+	FirstLine int    `json:"first_line,omitempty"`
+	LastLine  int    `json:"last_line,omitempty"`
+	Content   string `json:"content"`
+}
+
+// jsonDiff is the JSON representation of the git diff
+type jsonDiff struct {
+	Description string `json:"description"`
+	Part        int    `json:"part,omitempty"`
+	Parts       int    `json:"parts,omitempty"`
+	Content     string `json:"content"`
+}
+
+// jsonChunk is the JSON representation of the chunk a document belongs to
+type jsonChunk struct {
+	Index    int      `json:"index"`
+	Total    int      `json:"total"`
+	Contents []string `json:"contents"`
+}
+
+func newJSONFile(e Entry) jsonFile {
+	return jsonFile{
+		Path:      e.Path,
+		Language:  e.Language,
+		Size:      e.Size,
+		Lines:     lineCount(e.Content),
+		Mode:      e.Mode,
+		Part:      e.Part,
+		Parts:     e.Parts,
+		FirstLine: e.FirstLine,
+		LastLine:  e.LastLine,
+		Content:   e.Content,
+	}
+}
+
+func newJSONDiff(e Entry) jsonDiff {
+	return jsonDiff{Description: e.Path, Part: e.Part, Parts: e.Parts, Content: e.Content}
+}
+
+// lineCount returns the number of lines in the text, counting an unterminated last line
+func lineCount(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
+
+// marshalJSON encodes a value on a single line without escaping HTML characters
+func marshalJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// jsonFormatter writes a single JSON document with the directory tree and a files
+// array. Files are written as they arrive, one per line.
+type jsonFormatter struct {
+	files       int
+	filesClosed bool
+}
+
+func (f *jsonFormatter) Begin(w io.Writer, doc Document) error {
+	root, err := marshalJSON(doc.Root)
+	if err != nil {
+		return err
+	}
+	tree, err := marshalJSON(doc.Tree)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "{\n  \"root\": %s,\n", root)
+	if doc.Chunk > 0 {
+		chunk, err := marshalJSON(jsonChunk{Index: doc.Chunk, Total: doc.Chunks, Contents: doc.Contents})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sb, "  \"chunk\": %s,\n", chunk)
+	}
+	fmt.Fprintf(&sb, "  \"tree\": %s,\n  \"files\": [", tree)
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func (f *jsonFormatter) File(w io.Writer, e Entry) error {
+	data, err := marshalJSON(newJSONFile(e))
+	if err != nil {
+		return err
+	}
+
+	separator := "\n    "
+	if f.files > 0 {
+		separator = "," + separator
+	}
+	f.files++
+
+	_, err = io.WriteString(w, separator+data)
+	return err
+}
+
+func (f *jsonFormatter) Diff(w io.Writer, e Entry) error {
+	data, err := marshalJSON(newJSONDiff(e))
+	if err != nil {
+		return err
+	}
+	if err := f.closeFiles(w); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, ",\n  \"diff\": %s", data)
+	return err
+}
+
+func (f *jsonFormatter) End(w io.Writer) error {
+	if err := f.closeFiles(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n}\n")
+	return err
+}
+
+// closeFiles terminates the files array
+func (f *jsonFormatter) closeFiles(w io.Writer) error {
+	if f.filesClosed {
+		return nil
+	}
+	f.filesClosed = true
+	_, err := io.WriteString(w, "\n  ]")
+	return err
+}
+
+// jsonlFormatter writes one JSON object per line, tagged with a "type" field: an
+// optional "chunk" record, a "tree" record, one "file" record per file and a "diff" record
+type jsonlFormatter struct{}
+
+func (f *jsonlFormatter) Begin(w io.Writer, doc Document) error {
+	if doc.Chunk > 0 {
+		if err := f.record(w, struct {
+			Type string `json:"type"`
+			jsonChunk
+		}{"chunk", jsonChunk{Index: doc.Chunk, Total: doc.Chunks, Contents: doc.Contents}}); err != nil {
+			return err
+		}
+	}
+	if doc.Tree == "" {
+		return nil
+	}
+	return f.record(w, struct {
+		Type string `json:"type"`
+		Root string `json:"root"`
+		Tree string `json:"tree"`
+	}{"tree", doc.Root, doc.Tree})
+}
+
+func (f *jsonlFormatter) File(w io.Writer, e Entry) error {
+	return f.record(w, struct {
+		Type string `json:"type"`
+		jsonFile
+	}{"file", newJSONFile(e)})
+}
+
+func (f *jsonlFormatter) Diff(w io.Writer, e Entry) error {
+	return f.record(w, struct {
+		Type string `json:"type"`
+		jsonDiff
+	}{"diff", newJSONDiff(e)})
+}
+
+func (f *jsonlFormatter) End(w io.Writer) error {
+	return nil
+}
+
+// record writes a value as a single line
+func (f *jsonlFormatter) record(w io.Writer, v interface{}) error {
+	data, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, data+"\n")
+	return err
+}
+
+// languages maps file extensions to the language names used to tag code blocks
+var languages = map[string]string{
+	".go": "go", ".py": "python", ".pyi": "python", ".js": "javascript", ".mjs": "javascript", ".cjs": "javascript",
+	".jsx": "jsx", ".ts": "typescript", ".tsx": "tsx", ".java": "java", ".kt": "kotlin", ".kts": "kotlin",
+	".groovy": "groovy", ".gradle": "groovy", ".scala": "scala", ".rs": "rust", ".rb": "ruby", ".php": "php",
+	".c": "c", ".h": "c", ".cpp": "cpp", ".cc": "cpp", ".hpp": "cpp", ".cs": "csharp", ".swift": "swift",
+	".m": "objectivec", ".dart": "dart", ".lua": "lua", ".pl": "perl", ".r": "r", ".ex": "elixir", ".exs": "elixir",
+	".erl": "erlang", ".hs": "haskell", ".clj": "clojure", ".sh": "bash", ".bash": "bash", ".zsh": "zsh",
+	".ps1": "powershell", ".sql": "sql", ".html": "html", ".css": "css", ".scss": "scss", ".vue": "vue",
+	".svelte": "svelte", ".json": "json", ".xml": "xml", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml",
+	".ini": "ini", ".md": "markdown", ".tf": "hcl", ".hcl": "hcl", ".proto": "protobuf", ".mod": "go-mod",
+}
+
+// languageNames maps file names without a known extension to language names
+var languageNames = map[string]string{
+	"Makefile": "makefile", "Dockerfile": "dockerfile", "CMakeLists.txt": "cmake", "Jenkinsfile": "groovy",
+	"Gemfile": "ruby", "Rakefile": "ruby", "Vagrantfile": "ruby",
+}
+
+// languageOf returns the language of a file based on its name, or an empty string
+func languageOf(relPath string) string {
+	if lang, ok := languageNames[filepath.Base(relPath)]; ok {
+		return lang
+	}
+	return languages[strings.ToLower(filepath.Ext(relPath))]
+}
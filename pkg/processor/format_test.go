@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// render renders a complete document with a built-in format
+func render(t *testing.T, format string, doc Document, entries []Entry, diff *Entry) string {
+	t.Helper()
+
+	output, err := renderDocument(namedFormatter(format), doc, entries, diff)
+	if err != nil {
+		t.Fatalf("renderDocument(%s) error: %v", format, err)
+	}
+	return output
+}
+
+// tricky content that needs escaping in every format
+const trickyContent = "if a < b && c > d {\n\ts := \"]]>\" + `x`\n}\n```\ncode fence\n```\n"
+
+func formatTestEntries() ([]Entry, *Entry) {
+	entries := []Entry{
+		newEntry("main.go", []byte(trickyContent)),
+		newEntry("docs/README.md", []byte("# Title\n")),
+	}
+	diff := &Entry{Path: "changes since main", Content: "+added line\n"}
+	return entries, diff
+}
+
+// TestTextFormat tests the plain text format
+func TestTextFormat(t *testing.T) {
+	entries, diff := formatTestEntries()
+	output := render(t, FormatText, Document{Root: "root", Tree: "tree\n"}, entries, diff)
+
+	expected := "Directory Structure:\n\ntree\n\n" +
+		"---\nFile: main.go\n---\n\n" + trickyContent + "\n\n" +
+		"---\nFile: docs/README.md\n---\n\n# Title\n\n\n" +
+		"---\nGit Diff: changes since main\n---\n\n+added line\n\n"
+	if output != expected {
+		t.Errorf("Unexpected text output:\n%q\nwant:\n%q", output, expected)
+	}
+}
+
+// TestXMLFormat tests that the XML format is well-formed and preserves content
+func TestXMLFormat(t *testing.T) {
+	entries, diff := formatTestEntries()
+	output := render(t, FormatXML, Document{Root: "root", Tree: "a < b\n"}, entries, diff)
+
+	var parsed struct {
+		Tree      string `xml:"directory_structure"`
+		Documents []struct {
+			Index   int    `xml:"index,attr"`
+			Source  string `xml:"source"`
+			Content string `xml:"document_content"`
+		} `xml:"document"`
+		Diff struct {
+			Description string `xml:"description,attr"`
+			Content     string `xml:",chardata"`
+		} `xml:"git_diff"`
+	}
+	if err := xml.Unmarshal([]byte(output), &parsed); err != nil {
+		t.Fatalf("Invalid XML: %v\n%s", err, output)
+	}
+
+	if parsed.Tree != "\na < b\n" {
+		t.Errorf("tree = %q", parsed.Tree)
+	}
+	if len(parsed.Documents) != 2 {
+		t.Fatalf("Expected 2 documents, got %d", len(parsed.Documents))
+	}
+	if parsed.Documents[0].Index != 1 || parsed.Documents[1].Index != 2 {
+		t.Errorf("Unexpected document indexes: %d, %d", parsed.Documents[0].Index, parsed.Documents[1].Index)
+	}
+	if parsed.Documents[0].Source != "main.go" || parsed.Documents[0].Content != trickyContent {
+		t.Errorf("Content not preserved: %q", parsed.Documents[0].Content)
+	}
+	if parsed.Diff.Description != "changes since main" || parsed.Diff.Content != "+added line\n" {
+		t.Errorf("Unexpected diff: %+v", parsed.Diff)
+	}
+}
+
+// TestXMLFormatControlCharacters tests that contents with characters XML 1.0 does not
+// allow are encoded as base64 so the output stays well-formed
+func TestXMLFormatControlCharacters(t *testing.T) {
+	entries := []Entry{
+		newEntry("page.txt", []byte("page one\fpage two\n")),
+		newEntry("color.txt", []byte("\x1b[31mred\x1b[0m\n")),
+		newEntry("latin1.txt", []byte("caf\xe9\n")),
+		newEntry("plain.txt", []byte("tab\tand\r\nline\n")),
+	}
+	diff := &Entry{Path: "changes since main", Content: "+\x1b[1mbold\n"}
+	output := render(t, FormatXML, Document{Root: "root"}, entries, diff)
+
+	type content struct {
+		Encoding string `xml:"encoding,attr"`
+		Text     string `xml:",chardata"`
+	}
+	var parsed struct {
+		Documents []struct {
+			Source  string  `xml:"source"`
+			Content content `xml:"document_content"`
+		} `xml:"document"`
+		Diff content `xml:"git_diff"`
+	}
+	if err := xml.Unmarshal([]byte(output), &parsed); err != nil {
+		t.Fatalf("Invalid XML: %v\n%q", err, output)
+	}
+
+	decode := func(c content) string {
+		if c.Encoding != "base64" {
+			return c.Text
+		}
+		decoded, err := base64.StdEncoding.DecodeString(c.Text)
+		if err != nil {
+			t.Fatalf("Invalid base64 %q: %v", c.Text, err)
+		}
+		return string(decoded)
+	}
+
+	if len(parsed.Documents) != len(entries) {
+		t.Fatalf("Expected %d documents, got %d", len(entries), len(parsed.Documents))
+	}
+	for i, d := range parsed.Documents {
+		if got := decode(d.Content); got != entries[i].Content {
+			t.Errorf("%s: content = %q, want %q", d.Source, got, entries[i].Content)
+		}
+	}
+	if parsed.Documents[3].Content.Encoding != "" {
+		t.Errorf("plain.txt should not be encoded")
+	}
+	if got := decode(parsed.Diff); got != diff.Content {
+		t.Errorf("diff = %q, want %q", got, diff.Content)
+	}
+}
+
+// TestMarkdownFormat tests fenced blocks and language tags
+func TestMarkdownFormat(t *testing.T) {
+	entries, diff := formatTestEntries()
+	output := render(t, FormatMarkdown, Document{Root: "root", Tree: "tree\n"}, entries, diff)
+
+	expected := []string{
+		"## Directory Structure\n\n```text\ntree\n```\n",
+		"## main.go\n\n````go\n" + trickyContent + "````\n",
+		"## docs/README.md\n\n```markdown\n# Title\n```\n",
+		"## Git Diff: changes since main\n\n```diff\n+added line\n```\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Markdown output missing %q:\n%s", e, output)
+		}
+	}
+}
+
+// TestJSONFormat tests that the JSON format is a single valid document
+func TestJSONFormat(t *testing.T) {
+	entries, diff := formatTestEntries()
+
+	for _, withDiff := range []bool{false, true} {
+		d := diff
+		if !withDiff {
+			d = nil
+		}
+		output := render(t, FormatJSON, Document{Root: "root", Tree: "tree\n"}, entries, d)
+
+		var parsed struct {
+			Root  string     `json:"root"`
+			Tree  string     `json:"tree"`
+			Files []jsonFile `json:"files"`
+			Diff  *jsonDiff  `json:"diff"`
+		}
+		if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+			t.Fatalf("Invalid JSON: %v\n%s", err, output)
+		}
+
+		if parsed.Root != "root" || parsed.Tree != "tree\n" || len(parsed.Files) != 2 {
+			t.Fatalf("Unexpected document: %+v", parsed)
+		}
+		f := parsed.Files[0]
+		if f.Path != "main.go" || f.Language != "go" || f.Content != trickyContent || f.Size != len(trickyContent) || f.Lines != 6 || f.Mode != entryFull {
+			t.Errorf("Unexpected file metadata: %+v", f)
+		}
+		if withDiff != (parsed.Diff != nil) {
+			t.Errorf("diff present = %v, want %v", parsed.Diff != nil, withDiff)
+		}
+	}
+
+	// A document without files is still valid
+	output := render(t, FormatJSON, Document{Root: "root"}, nil, nil)
+	if !json.Valid([]byte(output)) {
+		t.Errorf("Invalid JSON for empty document:\n%s", output)
+	}
+}
+
+// TestJSONLFormat tests that every record is a JSON object on its own line
+func TestJSONLFormat(t *testing.T) {
+	entries, diff := formatTestEntries()
+	output := render(t, FormatJSONL, Document{Root: "root", Tree: "tree\n"}, entries, diff)
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	expectedTypes := []string{"tree", "file", "file", "diff"}
+	if len(lines) != len(expectedTypes) {
+		t.Fatalf("Expected %d lines, got %d:\n%s", len(expectedTypes), len(lines), output)
+	}
+
+	for i, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid JSON on line %d: %v", i+1, err)
+		}
+		if record["type"] != expectedTypes[i] {
+			t.Errorf("line %d type = %v, want %s", i+1, record["type"], expectedTypes[i])
+		}
+	}
+
+	var file jsonFile
+	if err := json.Unmarshal([]byte(lines[1]), &file); err != nil || file.Content != trickyContent {
+		t.Errorf("File content not preserved: %q (%v)", file.Content, err)
+	}
+}
+
+// TestUnknownFormat tests that unknown formats are rejected
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewProcessor(Config{DirPath: ".", IncludeFiles: []string{"*"}, Format: "yaml"}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+// TestLanguageOf tests language detection from file names
+func TestLanguageOf(t *testing.T) {
+	testCases := map[string]string{
+		"main.go":          "go",
+		"web/App.TSX":      "tsx",
+		"build/Dockerfile": "dockerfile",
+		"notes.unknown":    "",
+	}
+	for path, expected := range testCases {
+		if result := languageOf(path); result != expected {
+			t.Errorf("languageOf(%s) = %q, want %q", path, result, expected)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitDiffEnabled reports whether any changed-files mode is selected
+func (p *Processor) gitDiffEnabled() bool {
+	return p.config.GitDiffRef != "" || p.config.GitStaged || p.config.GitUnstaged
+}
+
+// gitDiffArgs returns the "git diff" argument sets for the selected modes
+func (p *Processor) gitDiffArgs() [][]string {
+	var sets [][]string
+	if p.config.GitDiffRef != "" {
+		// Compares the ref with the working tree, covering staged and unstaged changes.
+		// The ref is never parsed as an option, even if it starts with "-".
+		sets = append(sets, []string{"--end-of-options", p.config.GitDiffRef})
+	}
+	if p.config.GitStaged {
+		sets = append(sets, []string{"--cached"})
+	}
+	if p.config.GitUnstaged {
+		sets = append(sets, []string{})
+	}
+	return sets
+}
+
+// runGit runs a git command in DirPath and returns its standard output
+func (p *Processor) runGit(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", p.config.DirPath}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s failed: %s", strings.Join(args, " "), msg)
+	}
+	return out, nil
+}
+
+// loadChangedFiles asks git for the added, modified and renamed files of the selected
+// modes. Paths are relative to DirPath and slash-separated. Unstaged mode also
+// includes untracked files that are not ignored.
+func (p *Processor) loadChangedFiles() (map[string]bool, error) {
+	if err := p.verifyGitDiffRef(); err != nil {
+		return nil, err
+	}
+	changed := make(map[string]bool)
+
+	addPaths := func(out []byte) {
+		for _, path := range strings.Split(string(out), "\x00") {
+			if path != "" {
+				changed[path] = true
+			}
+		}
+	}
+
+	for _, args := range p.gitDiffArgs() {
+		cmdArgs := append([]string{"diff", "--name-only", "--relative", "-z", "--diff-filter=AMR"}, args...)
+		out, err := p.runGit(append(cmdArgs, "--", ".")...)
+		if err != nil {
+			return nil, err
+		}
+		addPaths(out)
+	}
+
+	if p.config.GitUnstaged {
+		out, err := p.runGit("ls-files", "--others", "--exclude-standard", "-z", "--", ".")
+		if err != nil {
+			return nil, err
+		}
+		addPaths(out)
+	}
+
+	return changed, nil
+}
+
+// verifyGitDiffRef checks that the ref of --git-diff names a commit
+func (p *Processor) verifyGitDiffRef() error {
+	if p.config.GitDiffRef == "" {
+		return nil
+	}
+	if _, err := p.runGit("rev-parse", "--verify", "--quiet", "--end-of-options", p.config.GitDiffRef+"^{commit}"); err != nil {
+		return fmt.Errorf("invalid git ref '%s': not a commit", p.config.GitDiffRef)
+	}
+	return nil
+}
+
+// isChangedFile reports whether a path relative to DirPath passes the changed-files filter
+func (p *Processor) isChangedFile(relPath string) bool {
+	if p.changedFiles == nil {
+		return true
+	}
+	return p.changedFiles[filepath.ToSlash(relPath)]
+}
+
+// gitDiff returns the unified diff of the selected modes, restricted to the given files
+func (p *Processor) gitDiff(files []string) (string, error) {
+	var sb strings.Builder
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, filepath.ToSlash(file))
+	}
+
+	// The diff against a ref already contains the staged and unstaged changes, which
+	// would otherwise be repeated
+	sets := p.gitDiffArgs()
+	if p.config.GitDiffRef != "" {
+		sets = sets[:1]
+	}
+	for _, args := range sets {
+		cmdArgs := append([]string{"diff", "--relative", "--no-color", "--diff-filter=AMR"}, args...)
+		cmdArgs = append(cmdArgs, "--")
+		out, err := p.runGit(append(cmdArgs, paths...)...)
+		if err != nil {
+			return "", err
+		}
+		sb.Write(out)
+	}
+
+	return sb.String(), nil
+}
+
+// gitDiffDescription describes the selected modes for the diff section header
+func (p *Processor) gitDiffDescription() string {
+	var parts []string
+	if p.config.GitDiffRef != "" {
+		parts = append(parts, p.config.GitDiffRef)
+	}
+	if p.config.GitStaged {
+		parts = append(parts, "staged")
+	}
+	if p.config.GitUnstaged {
+		parts = append(parts, "unstaged")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupGitRepo turns the standard test directory into a git repository with one
+// commit and returns its path
+func setupGitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tempDir := setupTestDir(t)
+	t.Cleanup(func() { cleanupTestDir(tempDir) })
+
+	// Isolate git from the user's configuration
+	t.Setenv("HOME", tempDir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempDir, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	runGit(t, tempDir, "init", "-q")
+	runGit(t, tempDir, "add", "-A")
+	runGit(t, tempDir, "commit", "-q", "-m", "initial")
+
+	return tempDir
+}
+
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// TestProcessWithGitDiff tests the changed-files modes
+func TestProcessWithGitDiff(t *testing.T) {
+	tempDir := setupGitRepo(t)
+
+	// Staged change
+	if err := os.WriteFile(filepath.Join(tempDir, "file2.go"), []byte("package main\n\nfunc main() { println(1) }\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	runGit(t, tempDir, "add", "file2.go")
+
+	// Unstaged change and untracked file
+	if err := os.WriteFile(filepath.Join(tempDir, "dir1", "file4.go"), []byte("package dir1\n\nvar X = 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "dir2", "new.txt"), []byte("new file\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		config        Config
+		expectedFiles []string
+	}{
+		{"staged", Config{GitStaged: true}, []string{"file2.go"}},
+		{"unstaged", Config{GitUnstaged: true}, []string{"dir1/file4.go", "dir2/new.txt"}},
+		{"since HEAD", Config{GitDiffRef: "HEAD"}, []string{"file2.go", "dir1/file4.go"}},
+		{"since HEAD filtered", Config{GitDiffRef: "HEAD", IncludeFiles: []string{"dir1/*"}}, []string{"dir1/file4.go"}},
+	}
+
+	allFiles := []string{"file1.txt", "file2.go", "dir1/file3.md", "dir1/file4.go", "dir2/file7.txt", "dir2/new.txt"}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.DirPath = tempDir
+			tc.config.Output = "-"
+			if tc.config.IncludeFiles == nil {
+				tc.config.IncludeFiles = []string{"*"}
+			}
+			output, _ := runProcess(t, tc.config)
+
+			expected := make(map[string]bool)
+			for _, file := range tc.expectedFiles {
+				expected[file] = true
+			}
+			for _, file := range allFiles {
+				included := strings.Contains(output, "File: "+file+"\n")
+				if included != expected[file] {
+					t.Errorf("File %s included = %v, want %v", file, included, expected[file])
+				}
+			}
+		})
+	}
+}
+
+// TestProcessWithGitDiffSection tests appending the unified diff
+func TestProcessWithGitDiffSection(t *testing.T) {
+	tempDir := setupGitRepo(t)
+
+	if err := os.WriteFile(filepath.Join(tempDir, "dir1", "file4.go"), []byte("package dir1\n\nvar X = 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+
+	// Scanning a subdirectory reports paths relative to it
+	output, _ := runProcess(t, Config{
+		DirPath:      filepath.Join(tempDir, "dir1"),
+		IncludeFiles: []string{"*"},
+		Output:       "-",
+		GitDiffRef:   "HEAD",
+		IncludeDiff:  true,
+	})
+
+	if !strings.Contains(output, "File: file4.go\n") {
+		t.Error("Output missing changed file")
+	}
+	if !strings.Contains(output, "---\nGit Diff: HEAD\n---\n") {
+		t.Error("Output missing git diff section")
+	}
+	if !strings.Contains(output, "+var X = 1") {
+		t.Error("Git diff section missing the change")
+	}
+
+	// The diff comes after the file contents
+	if strings.Index(output, "Git Diff:") < strings.Index(output, "File: file4.go") {
+		t.Error("Git diff section should follow the file contents")
+	}
+
+	// A ref combined with unstaged changes shows each change once
+	output, _ = runProcess(t, Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"*"},
+		Output:       "-",
+		GitDiffRef:   "HEAD",
+		GitUnstaged:  true,
+		IncludeDiff:  true,
+	})
+	if count := strings.Count(output, "+var X = 1"); count != 1 {
+		t.Errorf("Expected the change once in the diff, got %d times:\n%s", count, output)
+	}
+}
+
+// TestProcessWithInvalidGitDiffRef tests that refs are never passed to git as options
+func TestProcessWithInvalidGitDiffRef(t *testing.T) {
+	tempDir := setupGitRepo(t)
+	target := filepath.Join(t.TempDir(), "injected")
+
+	for _, ref := range []string{"--output=" + target, "does-not-exist", "HEAD:file1.txt"} {
+		processor, err := NewProcessor(Config{
+			DirPath:      tempDir,
+			IncludeFiles: []string{"*"},
+			Output:       filepath.Join(t.TempDir(), "out.txt"),
+			GitDiffRef:   ref,
+			IncludeDiff:  true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		if err := processor.Process(); err == nil || !strings.Contains(err.Error(), "invalid git ref") {
+			t.Errorf("%s: expected an invalid ref error, got: %v", ref, err)
+		}
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("A ref was parsed as a git option")
+	}
+}
@@ -0,0 +1,395 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern is a single compiled line from a gitignore-style file
+type ignorePattern struct {
+	base    string // Slash-separated directory the pattern is scoped to ("" for the top level)
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher evaluates gitignore-style patterns collected from one or more files.
+// Patterns added later take precedence over patterns added earlier, which mirrors
+// git's precedence rules as long as files are added from the outermost to the
+// innermost scope.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+// newIgnoreMatcher creates an empty matcher
+func newIgnoreMatcher() *ignoreMatcher {
+	return &ignoreMatcher{}
+}
+
+// AddPatterns compiles the given gitignore lines and scopes them to base
+func (m *ignoreMatcher) AddPatterns(base string, lines []string) error {
+	base = strings.Trim(filepath.ToSlash(base), "/")
+	if base == "." {
+		base = ""
+	}
+
+	for _, line := range lines {
+		pattern, ok, err := parseIgnorePattern(base, line)
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.patterns = append(m.patterns, pattern)
+		}
+	}
+
+	return nil
+}
+
+// AddFile reads a gitignore-style file and scopes its patterns to base.
+// A missing file is not an error.
+func (m *ignoreMatcher) AddFile(base, filePath string) error {
+	lines, err := readIgnoreFile(filePath)
+	if err != nil {
+		return err
+	}
+	return m.AddPatterns(base, lines)
+}
+
+// Match reports whether the slash-separated path is ignored
+func (m *ignoreMatcher) Match(relPath string, isDir bool) bool {
+	ignored, _ := m.match(relPath, isDir)
+	return ignored
+}
+
+// match returns the decision of the last pattern matching the path, and whether
+// any pattern matched at all
+func (m *ignoreMatcher) match(relPath string, isDir bool) (bool, bool) {
+	if m == nil {
+		return false, false
+	}
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+
+	// The last matching pattern decides, so walk the list backwards
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		pattern := m.patterns[i]
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+
+		target := relPath
+		if pattern.base != "" {
+			if !strings.HasPrefix(relPath, pattern.base+"/") {
+				continue
+			}
+			target = relPath[len(pattern.base)+1:]
+		}
+
+		if pattern.re.MatchString(target) {
+			return !pattern.negate, true
+		}
+	}
+
+	return false, false
+}
+
+// MatchTree reports whether the path or, failing a direct match, its nearest
+// matching parent directory is selected by the patterns. This is used for
+// allow-lists where "src/" should select every file below src.
+func (m *ignoreMatcher) MatchTree(relPath string) bool {
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+
+	if selected, ok := m.match(relPath, false); ok {
+		return selected
+	}
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if selected, ok := m.match(dir, true); ok {
+			return selected
+		}
+	}
+
+	return false
+}
+
+// InScope reports whether any pattern applies to the directory containing the path
+func (m *ignoreMatcher) InScope(relPath string) bool {
+	if m == nil {
+		return false
+	}
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+
+	for _, pattern := range m.patterns {
+		if pattern.base == "" || strings.HasPrefix(relPath, pattern.base+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readIgnoreFile reads the lines of a gitignore-style file, returning nil if it does not exist
+func readIgnoreFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open ignore file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file %s: %w", filePath, err)
+	}
+
+	return lines, nil
+}
+
+// parseIgnorePattern compiles a single gitignore line. The boolean result is false
+// for blank lines and comments.
+func parseIgnorePattern(base, line string) (ignorePattern, bool, error) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless they are escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false, nil
+	}
+
+	pattern := ignorePattern{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return ignorePattern{}, false, nil
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to its base
+	// directory; otherwise it may match at any depth below it
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if !anchored {
+		line = "**/" + line
+	}
+
+	re, err := regexp.Compile("^" + ignoreGlobToRegexp(line) + "$")
+	if err != nil {
+		return ignorePattern{}, false, fmt.Errorf("invalid ignore pattern '%s': %w", line, err)
+	}
+	pattern.re = re
+
+	return pattern, true, nil
+}
+
+// ignoreGlobToRegexp converts a gitignore glob into an equivalent regular expression
+func ignoreGlobToRegexp(glob string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				atStart := i == 0 || glob[i-1] == '/'
+				atEnd := i+2 == len(glob) || glob[i+2] == '/'
+				if atStart && atEnd {
+					if i+2 == len(glob) {
+						// Trailing "/**" matches everything inside
+						sb.WriteString(".*")
+					} else {
+						// Leading "**/" or inner "/**/" matches zero or more directories
+						sb.WriteString("(?:.*/)?")
+						i++ // Skip the following slash
+					}
+					i++
+					continue
+				}
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
+
+// findGitRoot returns the nearest directory at or above dir that contains a .git entry
+func findGitRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// loadGitignore builds a matcher with the global excludes file, .git/info/exclude and
+// every .gitignore between the repository root and dirPath. Nested .gitignore files
+// below dirPath are added while walking. The returned prefix is the slash-separated
+// location of dirPath relative to the repository root, and must be prepended to
+// paths passed to Match.
+func loadGitignore(dirPath string) (*ignoreMatcher, string, error) {
+	matcher := newIgnoreMatcher()
+
+	absDir, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	gitRoot, inRepo := findGitRoot(absDir)
+	if !inRepo {
+		gitRoot = absDir
+	}
+
+	if excludesFile := globalExcludesFile(gitRoot); excludesFile != "" {
+		if err := matcher.AddFile("", excludesFile); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if inRepo {
+		if err := matcher.AddFile("", filepath.Join(gitRoot, ".git", "info", "exclude")); err != nil {
+			return nil, "", err
+		}
+	}
+
+	prefix, err := filepath.Rel(gitRoot, absDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get relative path: %w", err)
+	}
+	prefix = filepath.ToSlash(prefix)
+	if prefix == "." {
+		prefix = ""
+	}
+
+	// Add .gitignore files from the repository root down to, but not including, dirPath
+	if prefix != "" {
+		dir := ""
+		for _, part := range strings.Split(prefix, "/") {
+			if err := matcher.AddFile(dir, filepath.Join(gitRoot, filepath.FromSlash(dir), ".gitignore")); err != nil {
+				return nil, "", err
+			}
+			dir = path.Join(dir, part)
+		}
+	}
+
+	return matcher, prefix, nil
+}
+
+// globalExcludesFile resolves core.excludesFile from the repository and user git
+// configuration, falling back to git's default location
+func globalExcludesFile(gitRoot string) string {
+	home, _ := os.UserHomeDir()
+
+	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" && home != "" {
+		xdgConfig = filepath.Join(home, ".config")
+	}
+
+	configFiles := []string{filepath.Join(gitRoot, ".git", "config")}
+	if home != "" {
+		configFiles = append(configFiles, filepath.Join(home, ".gitconfig"))
+	}
+	if xdgConfig != "" {
+		configFiles = append(configFiles, filepath.Join(xdgConfig, "git", "config"))
+	}
+
+	// The repository config has the highest precedence
+	for _, configFile := range configFiles {
+		if value := readGitConfigValue(configFile, "core", "excludesfile"); value != "" {
+			if strings.HasPrefix(value, "~/") && home != "" {
+				value = filepath.Join(home, value[2:])
+			}
+			return value
+		}
+	}
+
+	if xdgConfig != "" {
+		return filepath.Join(xdgConfig, "git", "ignore")
+	}
+	return ""
+}
+
+// readGitConfigValue returns the value of section.key from a git config file, or an
+// empty string if the file or key does not exist. Only the simple "key = value" form
+// is supported, which is sufficient for core.excludesFile.
+func readGitConfigValue(configFile, section, key string) string {
+	lines, err := readIgnoreFile(configFile)
+	if err != nil {
+		return ""
+	}
+
+	inSection := false
+	value := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			inSection = strings.EqualFold(name, section)
+			continue
+		}
+
+		if !inSection {
+			continue
+		}
+
+		name, val, found := strings.Cut(line, "=")
+		if found && strings.EqualFold(strings.TrimSpace(name), key) {
+			// Later assignments override earlier ones
+			value = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,201 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestIgnoreMatcher tests gitignore pattern semantics
+func TestIgnoreMatcher(t *testing.T) {
+	matcher := newIgnoreMatcher()
+	err := matcher.AddPatterns("", []string{
+		"# comment",
+		"",
+		"*.log",
+		"!keep.log",
+		"/build",
+		"node_modules/",
+		"docs/*.tmp",
+		"**/gen/**",
+		"\\#literal",
+	})
+	if err != nil {
+		t.Fatalf("AddPatterns failed: %v", err)
+	}
+	if err := matcher.AddPatterns("sub", []string{"local.txt", "/anchored.txt"}); err != nil {
+		t.Fatalf("AddPatterns failed: %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"app.log", false, true},
+		{"dir/app.log", false, true},
+		{"keep.log", false, false},
+		{"dir/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, true},
+		{"src/build", true, false},
+		{"node_modules", true, true},
+		{"src/node_modules", true, true},
+		{"node_modules", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/nested/a.tmp", false, false},
+		{"a/gen/b/c.go", false, true},
+		{"#literal", false, true},
+		{"sub/local.txt", false, true},
+		{"sub/deep/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/anchored.txt", false, true},
+		{"sub/deep/anchored.txt", false, false},
+		{"main.go", false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if result := matcher.Match(tc.path, tc.isDir); result != tc.expected {
+				t.Errorf("Match(%s, %v) = %v, want %v", tc.path, tc.isDir, result, tc.expected)
+			}
+		})
+	}
+}
+
+// TestReadGitConfigValue tests reading core.excludesFile from a git config file
+func TestReadGitConfigValue(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config")
+	content := "[user]\n\tname = test\n[core]\n\tbare = false\n\texcludesFile = \"~/global-ignore\"\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if value := readGitConfigValue(configPath, "core", "excludesfile"); value != "~/global-ignore" {
+		t.Errorf("readGitConfigValue = %q, want %q", value, "~/global-ignore")
+	}
+
+	if value := readGitConfigValue(configPath, "core", "missing"); value != "" {
+		t.Errorf("readGitConfigValue for missing key = %q, want empty", value)
+	}
+}
+
+// TestProcessWithGitignore tests that root, nested and info/exclude rules are honored
+func TestProcessWithGitignore(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	// Isolate the test from the user's global git configuration
+	t.Setenv("HOME", tempDir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tempDir, ".config"))
+
+	writeFiles(t, tempDir, map[string]string{
+		".gitignore":           "*.tmp\ndir2/\n",
+		"dir1/.gitignore":      "*.md\n!file3.md\nsubdir/file6.txt\n",
+		".git/info/exclude":    "file1.txt\n",
+		".config/git/ignore":   "file2.go\n",
+		"dir1/subdir/file9.md": "# Ignored by dir1/.gitignore",
+	})
+
+	run := func(noGitignore bool) string {
+		output, _ := runProcess(t, Config{
+			DirPath:      tempDir,
+			IncludeFiles: []string{"*"},
+			Output:       "-",
+			NoGitignore:  noGitignore,
+		})
+		return output
+	}
+
+	output := run(false)
+
+	expectedFiles := []string{"dir1/file3.md", "dir1/file4.go", "dir1/subdir/file5.go"}
+	for _, file := range expectedFiles {
+		if !strings.Contains(output, "File: "+file) {
+			t.Errorf("Output missing expected file: %s", file)
+		}
+	}
+
+	ignoredFiles := []string{"file1.txt", "file2.go", "dir1/subdir/file6.txt", "dir1/subdir/file9.md", "dir2/file7.txt", "dir2/file8.tmp"}
+	for _, file := range ignoredFiles {
+		if strings.Contains(output, "File: "+file) {
+			t.Errorf("Output contains gitignored file: %s", file)
+		}
+	}
+
+	// With --no-gitignore everything is back
+	output = run(true)
+	for _, file := range ignoredFiles {
+		if !strings.Contains(output, "File: "+file) {
+			t.Errorf("Output with NoGitignore missing file: %s", file)
+		}
+	}
+}
+
+// TestProcessWithPromptIgnoreFiles tests .dir2promptignore and .dir2promptinclude handling
+func TestProcessWithPromptIgnoreFiles(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		promptIgnoreFile:            "*.tmp\n",
+		"dir1/" + promptIgnoreFile:  "subdir/\n",
+		"dir2/" + promptIncludeFile: "file7.txt\n",
+		"dir2/file9.txt":            "Not in the include list",
+		"dir1/subdir/x.go":          "package subdir\n",
+		"dir1/extra/keep.go":        "package extra\n",
+	})
+
+	output, _ := runProcess(t, Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"*"},
+		ExcludeFiles: []string{"*.md"},
+		Output:       "-",
+	})
+
+	expectedFiles := []string{"file1.txt", "file2.go", "dir1/file4.go", "dir1/extra/keep.go", "dir2/file7.txt"}
+	for _, file := range expectedFiles {
+		if !strings.Contains(output, "File: "+file) {
+			t.Errorf("Output missing expected file: %s", file)
+		}
+	}
+
+	excludedFiles := []string{"dir1/file3.md", "dir1/subdir/file5.go", "dir2/file8.tmp", "dir2/file9.txt"}
+	for _, file := range excludedFiles {
+		if strings.Contains(output, "File: "+file) {
+			t.Errorf("Output contains excluded file: %s", file)
+		}
+	}
+
+	// The directory tree only shows selected files
+	if strings.Contains(output, "subdir") || strings.Contains(output, "file9.txt") {
+		t.Error("Directory structure contains files removed by prompt ignore files")
+	}
+}
+
+// TestIgnoreMatcherMatchTree tests allow-list matching through parent directories
+func TestIgnoreMatcherMatchTree(t *testing.T) {
+	matcher := newIgnoreMatcher()
+	if err := matcher.AddPatterns("", []string{"src/", "!src/generated/", "*.md"}); err != nil {
+		t.Fatalf("AddPatterns failed: %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"src/main.go", true},
+		{"src/pkg/util.go", true},
+		{"src/generated/types.go", false},
+		{"docs/guide.md", true},
+		{"main.go", false},
+	}
+
+	for _, tc := range testCases {
+		if result := matcher.MatchTree(tc.path); result != tc.expected {
+			t.Errorf("MatchTree(%s) = %v, want %v", tc.path, result, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/gobwas/glob"
+)
+
+const (
+	// GlobModeDoublestar matches patterns with '/'-aware doublestar semantics (the default)
+	GlobModeDoublestar = "doublestar"
+	// GlobModeLegacy matches patterns like versions before doublestar support, where
+	// '*' also matches '/'
+	GlobModeLegacy = "legacy"
+)
+
+// pathMatcher matches a relative file path against a compiled pattern
+type pathMatcher interface {
+	Match(relPath string) bool
+}
+
+// doublestarMatcher implements gitignore-style doublestar matching:
+//   - '*' and '?' never match '/', '**' matches zero or more directories, and
+//     brace alternatives and character classes are supported
+//   - a pattern without a slash matches the base name at any depth
+//   - a pattern with a slash is anchored to the scanned directory
+//   - a trailing slash matches directories, selecting every file below them
+type doublestarMatcher struct {
+	pattern  string
+	anchored bool
+	dirOnly  bool
+}
+
+// compileGlob compiles a pattern according to the glob mode
+func compileGlob(pattern, mode string) (pathMatcher, error) {
+	switch mode {
+	case "", GlobModeDoublestar:
+		return compileDoublestar(pattern)
+	case GlobModeLegacy:
+		return glob.Compile(pattern)
+	default:
+		return nil, fmt.Errorf("unknown glob mode '%s' (available: %s, %s)", mode, GlobModeDoublestar, GlobModeLegacy)
+	}
+}
+
+// compileDoublestar validates a pattern and returns its doublestar matcher
+func compileDoublestar(pattern string) (pathMatcher, error) {
+	m := &doublestarMatcher{}
+
+	pattern = filepath.ToSlash(pattern)
+	if len(pattern) > 1 && strings.HasSuffix(pattern, "/") {
+		m.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	m.anchored = strings.Contains(pattern, "/")
+	m.pattern = strings.TrimPrefix(pattern, "/")
+
+	if m.pattern == "" || !doublestar.ValidatePattern(m.pattern) {
+		return nil, doublestar.ErrBadPattern
+	}
+
+	return m, nil
+}
+
+// Match reports whether the path matches the pattern. Directory patterns match if
+// any parent directory of the path matches.
+func (m *doublestarMatcher) Match(relPath string) bool {
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	parts := strings.Split(relPath, "/")
+
+	if !m.dirOnly {
+		target := relPath
+		if !m.anchored {
+			target = parts[len(parts)-1]
+		}
+		matched, _ := doublestar.Match(m.pattern, target)
+		return matched
+	}
+
+	for i := 0; i < len(parts)-1; i++ {
+		target := parts[i]
+		if m.anchored {
+			target = strings.Join(parts[:i+1], "/")
+		}
+		if matched, _ := doublestar.Match(m.pattern, target); matched {
+			return true
+		}
+	}
+
+	return false
+}
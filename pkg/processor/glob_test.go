@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"testing"
+)
+
+// TestDoublestarMatcher tests the doublestar pattern semantics
+func TestDoublestarMatcher(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		// Patterns without a slash match the base name or a directory name at any depth
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/root.go", true},
+		{"*.go", "main.go.txt", false},
+		{"vendor", "vendor/lib/a.go", false},
+		// A trailing slash selects everything below matching directories
+		{"vendor/", "vendor", false},
+		{"vendor/", "vendor/a.go", true},
+		{"vendor/", "src/vendor/lib/a.go", true},
+		{"src/gen/", "src/gen/a/b.go", true},
+		{"src/gen/", "lib/src/gen/b.go", false},
+		// '*' does not cross '/'
+		{"vendor/*", "vendor/a.go", true},
+		{"vendor/*", "vendor/lib/a.go", false},
+		{"vendor/**", "vendor/lib/a.go", true},
+		{"src/*.go", "src/a.go", true},
+		{"src/*.go", "other/src/a.go", false},
+		// '**' matches zero or more directories
+		{"src/**/*.go", "src/a.go", true},
+		{"src/**/*.go", "src/pkg/deep/a.go", true},
+		{"src/**/*.go", "lib/src/a.go", false},
+		{"**/testdata/*.json", "testdata/a.json", true},
+		{"**/testdata/*.json", "pkg/testdata/a.json", true},
+		// Leading slash anchors the pattern
+		{"/main.go", "main.go", true},
+		{"/main.go", "cmd/main.go", false},
+		// Braces and character classes
+		{"*.{js,ts}", "web/app.ts", true},
+		{"*.{js,ts}", "web/app.go", false},
+		{"file[0-9].txt", "dir/file5.txt", true},
+		{"file[!0-9].txt", "dir/file5.txt", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.path, func(t *testing.T) {
+			m, err := compileDoublestar(tc.pattern)
+			if err != nil {
+				t.Fatalf("compileDoublestar(%s) error: %v", tc.pattern, err)
+			}
+			if result := m.Match(tc.path); result != tc.expected {
+				t.Errorf("Match(%s, %s) = %v, want %v", tc.pattern, tc.path, result, tc.expected)
+			}
+		})
+	}
+}
+
+// TestGlobModes tests the difference between the doublestar and legacy glob modes
+func TestGlobModes(t *testing.T) {
+	testCases := []struct {
+		mode     string
+		path     string
+		expected bool
+	}{
+		{GlobModeDoublestar, "docs/guide.md", true},
+		{GlobModeDoublestar, "docs/api/index.md", false},
+		{GlobModeLegacy, "docs/guide.md", true},
+		{GlobModeLegacy, "docs/api/index.md", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode+" "+tc.path, func(t *testing.T) {
+			processor, err := NewProcessor(Config{
+				DirPath:      ".",
+				IncludeFiles: []string{"docs/*.md"},
+				GlobMode:     tc.mode,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			if result := processor.shouldIncludeFile(tc.path); result != tc.expected {
+				t.Errorf("shouldIncludeFile(%s) = %v, want %v", tc.path, result, tc.expected)
+			}
+		})
+	}
+
+	if _, err := NewProcessor(Config{DirPath: ".", IncludeFiles: []string{"*"}, GlobMode: "regex"}); err == nil {
+		t.Error("Expected error for unknown glob mode, got nil")
+	}
+}
@@ -0,0 +1,163 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AutoPreset selects presets based on marker files found in the scanned directory
+const AutoPreset = "auto"
+
+// Preset is a curated set of include and exclude patterns for an ecosystem. Patterns
+// use doublestar syntax: a pattern without a slash matches a file or directory name
+// at any depth.
+type Preset struct {
+	Name        string
+	Markers     []string // Files (or glob patterns) in the root directory that identify the ecosystem
+	Include     []string // Patterns of source, manifest and documentation files
+	Exclude     []string // Patterns of generated files, lockfiles and build artifacts
+	ExcludeDirs []string // Directory names excluded at any depth
+	Tests       []string // Patterns of test files, excluded only when ExcludeTests is set
+}
+
+// Presets contains the built-in presets keyed by name
+var Presets = map[string]Preset{
+	"go": {
+		Name:        "go",
+		Markers:     []string{"go.mod", "go.work"},
+		Include:     []string{"*.go", "go.mod", "go.work", "*.proto", "*.md", "Makefile", "*.yaml", "*.yml"},
+		Exclude:     []string{"go.sum", "go.work.sum", "*.pb.go", "*.pb.gw.go", "*_string.go"},
+		ExcludeDirs: []string{"vendor"},
+		Tests:       []string{"*_test.go", "testdata/"},
+	},
+	"node": {
+		Name:    "node",
+		Markers: []string{"package.json"},
+		Include: []string{
+			"*.js", "*.jsx", "*.mjs", "*.cjs", "*.ts", "*.tsx", "*.vue", "*.svelte",
+			"*.css", "*.scss", "*.html", "*.json", "*.md",
+		},
+		Exclude: []string{
+			"package-lock.json", "yarn.lock", "pnpm-lock.yaml", "bun.lockb",
+			"*.min.js", "*.min.css", "*.map", "*.bundle.js", "*.chunk.js",
+		},
+		ExcludeDirs: []string{"node_modules", "dist", "build", "coverage", "out"},
+		Tests:       []string{"*.test.*", "*.spec.*", "__tests__/"},
+	},
+	"python": {
+		Name:    "python",
+		Markers: []string{"pyproject.toml", "setup.py", "setup.cfg", "requirements.txt", "Pipfile"},
+		Include: []string{
+			"*.py", "*.pyi", "pyproject.toml", "setup.py", "setup.cfg", "requirements*.txt", "Pipfile",
+			"*.md", "*.rst", "*.toml", "*.cfg", "*.ini",
+		},
+		Exclude:     []string{"*.pyc", "*.pyo", "poetry.lock", "Pipfile.lock", "uv.lock", "*.egg-info/"},
+		ExcludeDirs: []string{"__pycache__", "venv", "env", "build", "dist", "site-packages"},
+		Tests:       []string{"test_*.py", "*_test.py", "conftest.py", "tests/"},
+	},
+	"rust": {
+		Name:        "rust",
+		Markers:     []string{"Cargo.toml"},
+		Include:     []string{"*.rs", "Cargo.toml", "*.md", "*.toml"},
+		Exclude:     []string{"Cargo.lock"},
+		ExcludeDirs: []string{"target"},
+		Tests:       []string{"tests/", "benches/"},
+	},
+	"java": {
+		Name:    "java",
+		Markers: []string{"pom.xml", "build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts"},
+		Include: []string{
+			"*.java", "*.kt", "*.kts", "*.groovy", "*.gradle", "pom.xml",
+			"*.properties", "*.xml", "*.yaml", "*.yml", "*.md",
+		},
+		Exclude:     []string{"*.class", "*.jar", "gradlew", "gradlew.bat", "mvnw", "mvnw.cmd"},
+		ExcludeDirs: []string{"target", "build", "out", "bin"},
+		Tests:       []string{"**/src/test/"},
+	},
+	"terraform": {
+		Name:        "terraform",
+		Markers:     []string{"*.tf"},
+		Include:     []string{"*.tf", "*.hcl", "*.md", "*.tpl"},
+		Exclude:     []string{"*.tfstate", "*.tfstate.*", "*.tfplan", "crash.log", "crash.*.log"},
+		ExcludeDirs: []string{},
+		Tests:       []string{"*.tftest.hcl", "tests/"},
+	},
+}
+
+// PresetNames returns the sorted names of the built-in presets
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectPresets returns the presets whose marker files exist in dirPath
+func DetectPresets(dirPath string) []string {
+	var detected []string
+	for _, name := range PresetNames() {
+		for _, marker := range Presets[name].Markers {
+			matches, err := filepath.Glob(filepath.Join(dirPath, marker))
+			if err == nil && len(matches) > 0 {
+				detected = append(detected, name)
+				break
+			}
+		}
+	}
+	return detected
+}
+
+// expandPresets resolves the preset names (including "auto") and returns the
+// combined include and exclude patterns
+func expandPresets(names []string, dirPath string, excludeTests bool) ([]string, []string, error) {
+	var resolved []string
+	seen := make(map[string]bool)
+
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			resolved = append(resolved, name)
+		}
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == AutoPreset {
+			detected := DetectPresets(dirPath)
+			if len(detected) == 0 {
+				fmt.Fprintf(os.Stderr, "Warning: No preset could be detected in %s\n", dirPath)
+			}
+			for _, d := range detected {
+				add(d)
+			}
+			continue
+		}
+		if _, ok := Presets[name]; !ok {
+			return nil, nil, fmt.Errorf("unknown preset '%s' (available: %s, %s)", name, strings.Join(PresetNames(), ", "), AutoPreset)
+		}
+		add(name)
+	}
+
+	var include, exclude []string
+	for _, name := range resolved {
+		preset := Presets[name]
+		include = append(include, preset.Include...)
+		exclude = append(exclude, preset.Exclude...)
+		for _, dir := range preset.ExcludeDirs {
+			exclude = append(exclude, dir+"/")
+		}
+		if excludeTests {
+			exclude = append(exclude, preset.Tests...)
+		}
+	}
+
+	return include, exclude, nil
+}
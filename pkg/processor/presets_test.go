@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupPresetDir creates a small multi-ecosystem project for preset tests
+func setupPresetDir(t *testing.T) string {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"go.mod":                            "module example.com/demo\n",
+		"go.sum":                            "example.com/dep v1.0.0 h1:abc\n",
+		"main.go":                           "package main\n",
+		"main_test.go":                      "package main\n",
+		"api/api.pb.go":                     "package api\n",
+		"api/api.go":                        "package api\n",
+		"vendor/example.com/dep/dep.go":     "package dep\n",
+		"web/package.json":                  "{}\n",
+		"web/src/app.ts":                    "export {}\n",
+		"web/node_modules/lib/index.js":     "module.exports = {}\n",
+		"web/dist/app.min.js":               "var a=1;\n",
+		"README.md":                         "# Demo\n",
+		"notes.txt":                         "Not part of any preset\n",
+		"infra/main.tf":                     "resource \"null_resource\" \"x\" {}\n",
+		"infra/terraform.tfstate":           "{}\n",
+		"web/src/components/button.test.ts": "test()\n",
+	})
+	return tempDir
+}
+
+// TestDetectPresets tests preset detection from marker files
+func TestDetectPresets(t *testing.T) {
+	tempDir := setupPresetDir(t)
+
+	detected := DetectPresets(tempDir)
+	if len(detected) != 1 || detected[0] != "go" {
+		t.Errorf("DetectPresets(root) = %v, want [go]", detected)
+	}
+
+	detected = DetectPresets(filepath.Join(tempDir, "web"))
+	if len(detected) != 1 || detected[0] != "node" {
+		t.Errorf("DetectPresets(web) = %v, want [node]", detected)
+	}
+
+	detected = DetectPresets(filepath.Join(tempDir, "infra"))
+	if len(detected) != 1 || detected[0] != "terraform" {
+		t.Errorf("DetectPresets(infra) = %v, want [terraform]", detected)
+	}
+}
+
+// TestNewProcessorWithUnknownPreset tests that unknown presets are rejected
+func TestNewProcessorWithUnknownPreset(t *testing.T) {
+	_, err := NewProcessor(Config{DirPath: ".", Presets: []string{"cobol"}})
+	if err == nil || !strings.Contains(err.Error(), "unknown preset") {
+		t.Errorf("Expected unknown preset error, got: %v", err)
+	}
+}
+
+// TestProcessWithPresets tests combined and auto-detected presets
+func TestProcessWithPresets(t *testing.T) {
+	tempDir := setupPresetDir(t)
+
+	testCases := []struct {
+		name          string
+		config        Config
+		expectedFiles []string
+		excludedFiles []string
+	}{
+		{
+			name:          "go and node",
+			config:        Config{Presets: []string{"go", "node"}},
+			expectedFiles: []string{"go.mod", "main.go", "main_test.go", "api/api.go", "web/src/app.ts", "web/package.json", "README.md"},
+			excludedFiles: []string{"go.sum", "api/api.pb.go", "vendor/example.com/dep/dep.go", "web/node_modules/lib/index.js", "web/dist/app.min.js", "notes.txt"},
+		},
+		{
+			name:          "auto without tests",
+			config:        Config{Presets: []string{AutoPreset}, ExcludeTests: true},
+			expectedFiles: []string{"main.go", "api/api.go"},
+			excludedFiles: []string{"main_test.go", "go.sum", "notes.txt", "web/src/app.ts"},
+		},
+		{
+			name:          "preset with explicit includes",
+			config:        Config{Presets: []string{"terraform"}, IncludeFiles: []string{"*.txt"}},
+			expectedFiles: []string{"infra/main.tf", "notes.txt"},
+			excludedFiles: []string{"infra/terraform.tfstate", "main.go"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.DirPath = tempDir
+			tc.config.Output = "-"
+			output, _ := runProcess(t, tc.config)
+
+			for _, file := range tc.expectedFiles {
+				if !strings.Contains(output, "File: "+file+"\n") {
+					t.Errorf("Output missing expected file: %s", file)
+				}
+			}
+			for _, file := range tc.excludedFiles {
+				if strings.Contains(output, "File: "+file+"\n") {
+					t.Errorf("Output contains excluded file: %s", file)
+				}
+			}
+		})
+	}
+}
@@ -4,29 +4,99 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"text/template"
 
-	"github.com/gobwas/glob"
-	"github.com/pkoukk/tiktoken-go"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	// promptIgnoreFile lists gitignore-style patterns of files to keep out of the prompt
+	promptIgnoreFile = ".dir2promptignore"
+	// promptIncludeFile lists gitignore-style patterns of the only files allowed into the prompt
+	promptIncludeFile = ".dir2promptinclude"
 )
 
 // Config holds the configuration for the directory processor
 type Config struct {
-	DirPath        string
-	IncludeFiles   []string
-	ExcludeFiles   []string
-	Output         string
-	EstimateTokens bool
+	DirPath         string
+	IncludeFiles    []string
+	ExcludeFiles    []string
+	Output          string
+	EstimateTokens  bool
+	NoGitignore     bool     // Disable .gitignore, .git/info/exclude and core.excludesFile handling
+	Presets         []string // Built-in ecosystem presets to apply, or "auto" to detect them
+	ExcludeTests    bool     // Also exclude the test files defined by the selected presets
+	GitDiffRef      string   // Only include files changed between this ref and the working tree
+	GitStaged       bool     // Only include files with staged changes
+	GitUnstaged     bool     // Only include files with unstaged changes or untracked files
+	IncludeDiff     bool     // Append the unified diff of the changed files after their contents
+	Rev             string   // Read files from this git revision instead of the working tree
+	GlobMode        string   // Pattern semantics: "doublestar" (default) or "legacy"
+	IncludeRegex    []string // Regular expressions of relative paths to include
+	ExcludeRegex    []string // Regular expressions of relative paths to exclude
+	Contains        []string // Only include files whose content matches one of these regular expressions
+	NotContains     []string // Exclude files whose content matches any of these regular expressions
+	MaxTokens       int      // Token budget of the output, 0 for no limit
+	Priorities      []string // "pattern=weight" rules ranking files under a token budget
+	RankBy          []string // Tie-breakers for files of equal priority: recency, size, depth
+	ChunkTokens     int      // Split the output into numbered files of at most this many tokens, 0 to disable
+	Format          string   // Output format: text (default), xml, markdown, json or jsonl
+	Template        string   // Path of a text/template file rendering the output instead of Format
+	Boundary        string   // Delimiters of the text format: auto (default), hash, random or none
+	Tokenizer       string   // Tokenizer estimating tokens: a BPE encoding such as cl100k_base (default), chars or words
+	Model           string   // Model whose BPE encoding estimates tokens, instead of Tokenizer
+	TokenizerData   string   // Directory with .tiktoken files of the BPE encodings, to work offline
+	TreeAnnotate    []string // Metrics shown next to the nodes of the directory tree: size, lines and tokens
+	TreeScope       string   // Files shown in the directory tree: matched (default) or all non-ignored files
+	TreeExclude     []string // Patterns of files hidden from the directory tree
+	TreeMaxDepth    int      // Deepest level of the directory tree listed, deeper directories are summarized; 0 for no limit
+	TreeMaxChildren int      // Entries listed per directory before the rest is summarized; 0 for no limit
+	NoTree          bool     // Omit the directory tree from the output
+	Jobs            int      // Files detected and read concurrently, 0 for the number of CPUs
+	CacheDir        string   // Directory of the persistent metadata and token cache, empty to disable it
+	Report          string   // Format of the per-file token report on stderr: table or json, empty for none
 }
 
 // Processor handles the scanning and processing of files
 type Processor struct {
 	config         Config
-	includeMatches []glob.Glob
-	excludeMatches []glob.Glob
+	includeMatches []pathMatcher
+	excludeMatches []pathMatcher
+	treeExclude    []pathMatcher
+	treeFiles      []string // All non-ignored files when the tree scope is all
+	includeRegex   []*regexp.Regexp
+	excludeRegex   []*regexp.Regexp
+	containsRegex  []*regexp.Regexp
+	notContains    []*regexp.Regexp
+	gitignore      *ignoreMatcher
+	gitignoreBase  string // Location of DirPath relative to the git repository root
+	promptIgnore   *ignoreMatcher
+	promptInclude  *ignoreMatcher
+	changedFiles   map[string]bool         // Files reported by git in changed-files mode, nil otherwise
+	revisionFiles  map[string]*object.File // Matched blobs when reading from a git revision
+	priorities     []priorityRule
+	formatter      Formatter
+	template       *template.Template // Parsed Template, nil when a built-in format is used
+	boundary       string             // Boundary separating the text format sections, empty for "---" headers
+	tokenizer      string             // Resolved tokenizer name
+	tokenizerOnce  sync.Once
+	countTokens    func(string) int // Loaded on first use by loadTokenizer
+	tokenizerErr   error
+	cache          *fileCache // Persistent cache, nil when disabled
+	atomicOutput   bool       // Replace the output file only once it is complete
+	outputPath     string     // Relative path of the output file when it is excluded from the scan
+	stdout         io.Writer  // Destination of the output "-", os.Stdout when nil
+
+	// skip leaves further paths out of the scan, nil for none. The server applies the
+	// ignore files above the scanned directory with it.
+	skip func(relPath string, isDir bool) bool
 }
 
 // NewProcessor creates a new Processor with the given configuration
@@ -35,22 +105,140 @@ func NewProcessor(config Config) (*Processor, error) {
 		config: config,
 	}
 
+	if config.Rev != "" && (config.GitDiffRef != "" || config.GitStaged || config.GitUnstaged) {
+		return nil, fmt.Errorf("reading from a revision cannot be combined with changed-files mode")
+	}
+
 	// Compile include patterns
 	for _, pattern := range config.IncludeFiles {
-		g, err := glob.Compile(pattern)
+		m, err := compileGlob(pattern, config.GlobMode)
 		if err != nil {
 			return nil, fmt.Errorf("invalid include pattern '%s': %w", pattern, err)
 		}
-		p.includeMatches = append(p.includeMatches, g)
+		p.includeMatches = append(p.includeMatches, m)
 	}
 
 	// Compile exclude patterns
 	for _, pattern := range config.ExcludeFiles {
-		g, err := glob.Compile(pattern)
+		m, err := compileGlob(pattern, config.GlobMode)
 		if err != nil {
 			return nil, fmt.Errorf("invalid exclude pattern '%s': %w", pattern, err)
 		}
-		p.excludeMatches = append(p.excludeMatches, g)
+		p.excludeMatches = append(p.excludeMatches, m)
+	}
+
+	// Compile the patterns hiding files from the directory tree
+	for _, pattern := range config.TreeExclude {
+		m, err := compileGlob(pattern, config.GlobMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tree exclude pattern '%s': %w", pattern, err)
+		}
+		p.treeExclude = append(p.treeExclude, m)
+	}
+
+	// Compile regular expressions
+	regexLists := []struct {
+		kind     string
+		patterns []string
+		target   *[]*regexp.Regexp
+	}{
+		{"include regex", config.IncludeRegex, &p.includeRegex},
+		{"exclude regex", config.ExcludeRegex, &p.excludeRegex},
+		{"contains regex", config.Contains, &p.containsRegex},
+		{"not-contains regex", config.NotContains, &p.notContains},
+	}
+	for _, list := range regexLists {
+		for _, pattern := range list.patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s '%s': %w", list.kind, pattern, err)
+			}
+			*list.target = append(*list.target, re)
+		}
+	}
+
+	if config.Template != "" {
+		tmpl, err := loadTemplate(config.Template)
+		if err != nil {
+			return nil, err
+		}
+		p.template = tmpl
+	}
+	formatter, err := p.newFormatter()
+	if err != nil {
+		return nil, err
+	}
+	p.formatter = formatter
+	if err := validateBoundaryMode(config.Boundary); err != nil {
+		return nil, err
+	}
+	if p.tokenizer, err = resolveTokenizer(config.Tokenizer, config.Model); err != nil {
+		return nil, err
+	}
+	if err := validateReportFormat(config.Report); err != nil {
+		return nil, err
+	}
+	if err := validateTreeAnnotations(config.TreeAnnotate); err != nil {
+		return nil, err
+	}
+	if err := validateTreeScope(config.TreeScope); err != nil {
+		return nil, err
+	}
+	if config.TreeMaxDepth < 0 || config.TreeMaxChildren < 0 {
+		return nil, fmt.Errorf("tree limits must not be negative")
+	}
+	if config.Jobs < 0 {
+		return nil, fmt.Errorf("jobs must not be negative")
+	}
+
+	// Parse the ranking rules used by the token budget
+	for _, rule := range config.Priorities {
+		r, err := parsePriorityRule(rule, config.GlobMode)
+		if err != nil {
+			return nil, err
+		}
+		p.priorities = append(p.priorities, r)
+	}
+	if err := validateRankBy(config.RankBy); err != nil {
+		return nil, err
+	}
+	if config.ChunkTokens < 0 {
+		return nil, fmt.Errorf("invalid chunk size %d: must not be negative", config.ChunkTokens)
+	}
+	if config.ChunkTokens > 0 && (config.Output == "" || config.Output == "-") {
+		return nil, fmt.Errorf("chunked output requires an output file to derive the chunk file names from")
+	}
+	if config.MaxTokens < 0 {
+		return nil, fmt.Errorf("invalid token budget %d: must not be negative", config.MaxTokens)
+	}
+
+	// Expand presets into additional include and exclude patterns. Presets are written
+	// in doublestar syntax regardless of the glob mode.
+	if len(config.Presets) > 0 {
+		presetInclude, presetExclude, err := expandPresets(config.Presets, config.DirPath, config.ExcludeTests)
+		if err != nil {
+			return nil, err
+		}
+		for _, pattern := range presetInclude {
+			m, err := compileDoublestar(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid preset pattern '%s': %w", pattern, err)
+			}
+			p.includeMatches = append(p.includeMatches, m)
+		}
+		for _, pattern := range presetExclude {
+			m, err := compileDoublestar(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid preset pattern '%s': %w", pattern, err)
+			}
+			p.excludeMatches = append(p.excludeMatches, m)
+		}
+
+		// Fall back to including everything if no preset was detected
+		if len(p.includeMatches) == 0 {
+			m, _ := compileDoublestar("*")
+			p.includeMatches = append(p.includeMatches, m)
+		}
 	}
 
 	return p, nil
@@ -59,7 +247,6 @@ func NewProcessor(config Config) (*Processor, error) {
 // Process scans the directory and processes the files
 func (p *Processor) Process() error {
 	var writer io.Writer
-	var totalContent strings.Builder // Used to collect all content for token estimation
 
 	// Special handling for "." (current directory)
 	if p.config.DirPath == "." {
@@ -71,10 +258,36 @@ func (p *Processor) Process() error {
 		p.config.DirPath = currentDir
 	}
 
-	// Determine the output destination
-	if p.config.Output == "" || p.config.Output == "-" {
+	// Reuse the metadata and token counts of earlier runs
+	if p.config.CacheDir != "" {
+		if p.cache == nil {
+			p.cache = loadCache(p.config.CacheDir, p.config.DirPath)
+		}
+		defer func() {
+			if err := p.cache.save(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}()
+	}
+
+	// Determine the output destination; chunked output creates its own files
+	complete := func() error { return nil }
+	switch {
+	case p.config.ChunkTokens > 0:
+		// Chunk files are created once the output has been split
+	case p.config.Output == "" || p.config.Output == "-":
 		writer = os.Stdout
-	} else {
+		if p.stdout != nil {
+			writer = p.stdout
+		}
+	case p.atomicOutput:
+		file, err := createAtomic(p.config.Output)
+		if err != nil {
+			return err
+		}
+		defer file.discard()
+		writer, complete = file, file.commit
+	default:
 		file, err := os.Create(p.config.Output)
 		if err != nil {
 			return fmt.Errorf("failed to create output file: %w", err)
@@ -84,8 +297,205 @@ func (p *Processor) Process() error {
 	}
 
 	// First collect all matching files
-	matchedFiles := []string{}
-	err := filepath.Walk(p.config.DirPath, func(path string, info os.FileInfo, err error) error {
+	matchedFiles, err := p.collectFiles()
+	if err != nil {
+		return err
+	}
+
+	// Check if any text files were found
+	if len(matchedFiles) == 0 {
+		fmt.Fprintf(os.Stderr, "No text files found or all matched files were binary.\n")
+		return complete()
+	}
+
+	// Sort files to ensure consistent output
+	sort.Strings(matchedFiles)
+
+	// Generate the directory structure and the optional unified diff up front so the
+	// token budget can account for them
+	doc := Document{Root: filepath.Base(p.config.DirPath)}
+	if !p.config.NoTree {
+		tree := p.directoryTree(matchedFiles)
+		if len(p.config.TreeAnnotate) > 0 {
+			if err := p.annotateTree(tree); err != nil {
+				return fmt.Errorf("failed to annotate directory structure: %w", err)
+			}
+		}
+		doc.Tree = p.generateDirectoryStructure(tree)
+		doc.Nodes = tree.Children
+	}
+
+	var diffEntry *Entry
+	if p.config.IncludeDiff && p.gitDiffEnabled() {
+		diff, err := p.gitDiff(matchedFiles)
+		if err != nil {
+			return fmt.Errorf("failed to get git diff: %w", err)
+		}
+		diffEntry = &Entry{Path: p.gitDiffDescription(), Content: diff}
+	}
+
+	// Pick a boundary that cannot collide with the included content
+	texts := []string{doc.Tree}
+	if diffEntry != nil {
+		texts = append(texts, diffEntry.Path, diffEntry.Content)
+	}
+	if p.boundary, err = p.chooseBoundary(matchedFiles, texts...); err != nil {
+		return err
+	}
+	if p.formatter, err = p.newFormatter(); err != nil {
+		return err
+	}
+
+	// Decide how each file is written when the output has a token budget
+	var plan *budgetPlan
+	if p.config.MaxTokens > 0 {
+		plan, err = p.planBudget(matchedFiles, doc, diffEntry)
+		if err != nil {
+			return fmt.Errorf("failed to plan token budget: %w", err)
+		}
+	}
+
+	// Write the output, split into chunk files if requested. Chunks are counted one by
+	// one, a single output while it is written.
+	var tokens int
+	if p.config.ChunkTokens > 0 {
+		chunkTokens, err := p.writeChunks(matchedFiles, doc, diffEntry, plan)
+		if err != nil {
+			return err
+		}
+		tokens = chunkTokens
+	} else {
+		var counter *tokenCounter
+		if p.config.EstimateTokens {
+			if counter, err = p.newTokenCounter(); err != nil {
+				return fmt.Errorf("failed to estimate tokens: %w", err)
+			}
+		}
+		if err := p.writeOutput(writer, counter, matchedFiles, doc, diffEntry, plan); err != nil {
+			return err
+		}
+		if counter != nil {
+			tokens = counter.tokens()
+		}
+		if err := complete(); err != nil {
+			return err
+		}
+	}
+
+	// Report which files did not fit into the token budget
+	if plan != nil {
+		plan.report(os.Stderr)
+	}
+
+	// Print the token report or the estimation to stderr
+	if p.config.Report != "" {
+		report, err := p.buildReport(matchedFiles, plan)
+		if err != nil {
+			return fmt.Errorf("failed to build token report: %w", err)
+		}
+		report.OutputTokens = tokens
+		if err := report.write(os.Stderr, p.config.Report); err != nil {
+			return fmt.Errorf("failed to write token report: %w", err)
+		}
+	} else if p.config.EstimateTokens {
+		tokenizer, err := p.loadedTokenizer()
+		if err != nil {
+			return fmt.Errorf("failed to estimate tokens: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "\nEstimated tokens: %d (%s)\n", tokens, tokenizer)
+	}
+
+	return nil
+}
+
+// writeOutput writes the directory structure, the matched files and the optional diff
+// section to a single writer, counting the tokens with counter unless it is nil
+func (p *Processor) writeOutput(writer io.Writer, counter *tokenCounter, matchedFiles []string, doc Document, diffEntry *Entry, plan *budgetPlan) error {
+	if counter != nil {
+		writer = io.MultiWriter(writer, counter)
+	}
+
+	// Write the directory structure
+	if err := p.formatter.Begin(writer, doc); err != nil {
+		return fmt.Errorf("failed to write directory structure: %w", err)
+	}
+
+	// Process each matched file, reading ahead concurrently unless the plan holds the content
+	if plan != nil {
+		for _, relPath := range matchedFiles {
+			entry, ok := plan.entry(relPath)
+			if !ok {
+				continue
+			}
+			counter.cut()
+			if err := p.formatter.File(writer, entry); err != nil {
+				return fmt.Errorf("failed to process file %s: %w", relPath, err)
+			}
+		}
+	} else if err := p.readFiles(matchedFiles, func(relPath string, content []byte) error {
+		counter.cut()
+		if err := p.formatter.File(writer, newEntry(relPath, content)); err != nil {
+			return fmt.Errorf("failed to process file %s: %w", relPath, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Append the unified diff after the file contents
+	if diffEntry != nil {
+		if err := p.formatter.Diff(writer, *diffEntry); err != nil {
+			return fmt.Errorf("failed to write git diff: %w", err)
+		}
+	}
+
+	if err := p.formatter.End(writer); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
+// newFormatter creates the formatter for an output document
+func (p *Processor) newFormatter() (Formatter, error) {
+	if p.template != nil {
+		return newTemplateFormatter(p.template, p.estimateTokens), nil
+	}
+	if p.boundary != "" {
+		return &textFormatter{boundary: p.boundary}, nil
+	}
+	return NewFormatter(p.config.Format)
+}
+
+// collectFiles walks the directory and returns the relative paths of all matching text files
+func (p *Processor) collectFiles() ([]string, error) {
+	p.treeFiles = nil
+	if p.config.Rev != "" {
+		return p.collectRevisionFiles()
+	}
+
+	if !p.config.NoGitignore {
+		matcher, base, err := loadGitignore(p.config.DirPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load gitignore: %w", err)
+		}
+		p.gitignore = matcher
+		p.gitignoreBase = base
+	}
+	p.promptIgnore = newIgnoreMatcher()
+	p.promptInclude = newIgnoreMatcher()
+
+	if p.gitDiffEnabled() {
+		changed, err := p.loadChangedFiles()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list changed files: %w", err)
+		}
+		p.changedFiles = changed
+	}
+
+	// Walk the directory for candidates by name; their content is checked concurrently below
+	var candidates []string
+	err := filepath.WalkDir(p.config.DirPath, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -97,159 +507,148 @@ func (p *Processor) Process() error {
 		}
 
 		// Skip .git directories and hidden directories (starting with .)
-		if info.IsDir() {
+		if entry.IsDir() {
 			// Skip .git directories
-			if info.Name() == ".git" {
+			if entry.Name() == ".git" {
 				return filepath.SkipDir
 			}
 
 			// Skip hidden directories (starting with .)
-			if strings.HasPrefix(info.Name(), ".") && info.Name() != "." {
+			if strings.HasPrefix(entry.Name(), ".") && entry.Name() != "." {
 				return filepath.SkipDir
 			}
 
+			if relPath != "." && p.isGitignored(relPath, true) {
+				return filepath.SkipDir
+			}
+
+			if relPath != "." && p.promptIgnore.Match(relPath, true) {
+				return filepath.SkipDir
+			}
+
+			if relPath != "." && p.skip != nil && p.skip(relPath, true) {
+				return filepath.SkipDir
+			}
+
+			// Nested .gitignore files apply to their own subtree
+			if p.gitignore != nil {
+				if err := p.gitignore.AddFile(p.gitignorePath(relPath), filepath.Join(path, ".gitignore")); err != nil {
+					return err
+				}
+			}
+
+			// So do the project-level prompt ignore and include files
+			if err := p.promptIgnore.AddFile(relPath, filepath.Join(path, promptIgnoreFile)); err != nil {
+				return err
+			}
+			if err := p.promptInclude.AddFile(relPath, filepath.Join(path, promptIncludeFile)); err != nil {
+				return err
+			}
+
 			return nil
 		}
 
 		// Skip .gitignore and other hidden files (starting with .)
-		if strings.HasPrefix(info.Name(), ".") {
+		if strings.HasPrefix(entry.Name(), ".") {
 			return nil
 		}
 
 		// Skip symbolic links
-		if info.Mode()&os.ModeSymlink != 0 {
+		if entry.Type()&fs.ModeSymlink != 0 {
 			return nil
 		}
 
-		// Check if the file should be included
-		if p.shouldIncludeFile(relPath) {
-			// Pre-check if it's a text file
-			isText, err := isTextFile(path)
-			if err != nil {
-				return fmt.Errorf("failed to check if file is text: %w", err)
-			}
-
-			if isText {
-				matchedFiles = append(matchedFiles, relPath)
-			} else {
-				fmt.Fprintf(os.Stderr, "Warning: Skipping binary file: %s\n", relPath)
-			}
+		// Skip the output file written by watch mode
+		if p.outputPath != "" && filepath.ToSlash(relPath) == p.outputPath {
+			return nil
 		}
 
-		return nil
-	})
-
-	if err != nil {
-		return err
-	}
-
-	// Check if any text files were found
-	if len(matchedFiles) == 0 {
-		fmt.Fprintf(os.Stderr, "No text files found or all matched files were binary.\n")
-		return nil
-	}
-
-	// Generate and write the directory structure
-	dirStructure := p.generateDirectoryStructure(matchedFiles)
-	totalContent.WriteString(dirStructure)
-	if _, err := writer.Write([]byte(dirStructure)); err != nil {
-		return fmt.Errorf("failed to write directory structure: %w", err)
-	}
-
-	// Process each matched file
-	for _, relPath := range matchedFiles {
-		absPath := filepath.Join(p.config.DirPath, relPath)
-
-		// Create a buffer if we're estimating tokens
-		var contentBuffer bytes.Buffer
+		// Skip files ignored by git
+		if p.isGitignored(relPath, false) {
+			return nil
+		}
+		if p.skip != nil && p.skip(relPath, false) {
+			return nil
+		}
 
-		// Process to both writer and buffer if estimating tokens
-		var currentWriter io.Writer
-		if p.config.EstimateTokens {
-			currentWriter = io.MultiWriter(writer, &contentBuffer)
-		} else {
-			currentWriter = writer
+		// Every remaining file is part of the tree when it covers the whole project
+		if p.config.TreeScope == TreeScopeAll && p.isPromptSelected(relPath) {
+			p.treeFiles = append(p.treeFiles, relPath)
 		}
 
-		if err := p.processFile(absPath, relPath, currentWriter); err != nil {
-			return fmt.Errorf("failed to process file %s: %w", relPath, err)
+		// In changed-files mode, skip files git does not report as changed
+		if !p.isChangedFile(relPath) {
+			return nil
 		}
 
-		// Add content for token estimation
-		if p.config.EstimateTokens {
-			totalContent.WriteString(contentBuffer.String())
+		// Skip files ignored by .dir2promptignore or not listed in an applicable .dir2promptinclude
+		if !p.isPromptSelected(relPath) {
+			return nil
 		}
-	}
 
-	// Estimate tokens if needed
-	if p.config.EstimateTokens {
-		tokens, err := p.estimateTokens(totalContent.String())
-		if err != nil {
-			return fmt.Errorf("failed to estimate tokens: %w", err)
+		// Check if the file should be included
+		if p.shouldIncludeFile(relPath) {
+			candidates = append(candidates, relPath)
 		}
 
-		// Print token estimation to stderr
-		fmt.Fprintf(os.Stderr, "\nEstimated tokens: %d\n", tokens)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	// Keep the text files that pass the content filters
+	return p.checkFiles(candidates)
 }
 
-// generateDirectoryStructure creates a tree-like representation of the directory structure
-func (p *Processor) generateDirectoryStructure(files []string) string {
-	if len(files) == 0 {
-		return "No files matched the criteria.\n\n"
+// gitignorePath converts a path relative to DirPath into one relative to the git repository root
+func (p *Processor) gitignorePath(relPath string) string {
+	relPath = filepath.ToSlash(relPath)
+	if relPath == "." {
+		relPath = ""
 	}
-
-	// Sort files to ensure consistent output
-	sort.Strings(files)
-
-	// Build a tree structure
-	type Node struct {
-		Name     string
-		IsDir    bool
-		Children map[string]*Node
+	if p.gitignoreBase == "" {
+		return relPath
 	}
-
-	root := &Node{
-		Name:     "./",
-		IsDir:    true,
-		Children: make(map[string]*Node),
+	if relPath == "" {
+		return p.gitignoreBase
 	}
+	return p.gitignoreBase + "/" + relPath
+}
 
-	// Add files to the tree
-	for _, file := range files {
-		// Convert backslashes to forward slashes for consistency
-		file = filepath.ToSlash(file)
-
-		parts := strings.Split(file, "/")
-		currentNode := root
-
-		// Build the directory structure
-		for i, part := range parts {
-			isFile := i == len(parts)-1
+// isGitignored reports whether a path relative to DirPath is ignored by git
+func (p *Processor) isGitignored(relPath string, isDir bool) bool {
+	if p.gitignore == nil {
+		return false
+	}
+	return p.gitignore.Match(p.gitignorePath(relPath), isDir)
+}
 
-			if _, exists := currentNode.Children[part]; !exists {
-				currentNode.Children[part] = &Node{
-					Name:     part,
-					IsDir:    !isFile,
-					Children: make(map[string]*Node),
-				}
-			}
+// isPromptSelected applies the .dir2promptignore and .dir2promptinclude files to a
+// file path relative to DirPath. These layer on top of the include/exclude patterns.
+func (p *Processor) isPromptSelected(relPath string) bool {
+	if p.promptIgnore.Match(relPath, false) {
+		return false
+	}
+	if p.promptInclude.InScope(relPath) && !p.promptInclude.MatchTree(relPath) {
+		return false
+	}
+	return true
+}
 
-			if !isFile {
-				currentNode = currentNode.Children[part]
-			}
-		}
+// generateDirectoryStructure creates a tree-like representation of the directory structure
+func (p *Processor) generateDirectoryStructure(root *TreeNode) string {
+	if len(root.Children) == 0 {
+		return "No files matched the criteria.\n"
 	}
 
 	// Render the tree
 	var sb strings.Builder
-	sb.WriteString("Directory Structure:\n\n")
 
 	// Define a recursive function to print the tree
-	var printTree func(node *Node, prefix string, isLast bool, isRoot bool)
-	printTree = func(node *Node, prefix string, isLast bool, isRoot bool) {
+	var printTree func(node *TreeNode, prefix string, isLast bool, isRoot bool, depth int)
+	printTree = func(node *TreeNode, prefix string, isLast bool, isRoot bool, depth int) {
 		// Prepare the line prefix
 		var nodePrefix string
 		if isRoot {
@@ -260,11 +659,15 @@ func (p *Processor) generateDirectoryStructure(files []string) string {
 			nodePrefix = "├── "
 		}
 
-		// Print the current node
+		// Print the current node, summarizing the contents of collapsed directories
+		collapsed := !isRoot && p.isCollapsed(node, depth)
 		if isRoot {
-			sb.WriteString(nodePrefix + node.Name + "\n")
+			sb.WriteString(nodePrefix + node.Name + p.treeAnnotation(node) + "\n")
+		} else if collapsed {
+			sb.WriteString(prefix + nodePrefix + node.Name + "/" + p.treeAnnotation(node, summarizeFiles(node)) + "\n")
+			return
 		} else {
-			sb.WriteString(prefix + nodePrefix + node.Name + "\n")
+			sb.WriteString(prefix + nodePrefix + node.Name + p.treeAnnotation(node) + p.treeMarker(node) + "\n")
 		}
 
 		// Process children
@@ -277,42 +680,42 @@ func (p *Processor) generateDirectoryStructure(files []string) string {
 			}
 		}
 
-		// Convert the map to a sorted slice for consistent output
-		var children []*Node
-		for _, child := range node.Children {
-			children = append(children, child)
+		// Print each child, up to the limit of entries per directory
+		children, hidden := node.Children, []*TreeNode(nil)
+		if limit := p.config.TreeMaxChildren; limit > 0 && len(children) > limit {
+			children, hidden = children[:limit], children[limit:]
 		}
-
-		// Sort children (directories first, then by name)
-		sort.Slice(children, func(i, j int) bool {
-			if children[i].IsDir != children[j].IsDir {
-				return children[i].IsDir // Directories come first
-			}
-			return children[i].Name < children[j].Name // Alphabetical order
-		})
-
-		// Print each child
 		for i, child := range children {
-			isLastChild := i == len(children)-1
-			printTree(child, childPrefix, isLastChild, false)
+			isLastChild := i == len(children)-1 && len(hidden) == 0
+			printTree(child, childPrefix, isLastChild, false, depth+1)
+		}
+		if len(hidden) > 0 {
+			sb.WriteString(childPrefix + "└── … " + summarizeHidden(hidden) + "\n")
 		}
 	}
 
 	// Start the recursive printing
-	printTree(root, "", true, true)
+	printTree(root, "", true, true, 0)
 
-	sb.WriteString("\n")
 	return sb.String()
 }
 
 // shouldIncludeFile checks if a file should be included based on the include/exclude patterns
+// and regular expressions
 func (p *Processor) shouldIncludeFile(relPath string) bool {
+	slashPath := filepath.ToSlash(relPath)
+
 	// First check if the file is excluded
 	for _, matcher := range p.excludeMatches {
 		if matcher.Match(relPath) {
 			return false
 		}
 	}
+	for _, re := range p.excludeRegex {
+		if re.MatchString(slashPath) {
+			return false
+		}
+	}
 
 	// Then check if the file is included
 	for _, matcher := range p.includeMatches {
@@ -320,56 +723,99 @@ func (p *Processor) shouldIncludeFile(relPath string) bool {
 			return true
 		}
 	}
+	for _, re := range p.includeRegex {
+		if re.MatchString(slashPath) {
+			return true
+		}
+	}
 
 	// If no include patterns match, exclude the file
 	return false
 }
 
+// hasContentFilters reports whether files must be read to decide if they are included
+func (p *Processor) hasContentFilters() bool {
+	return len(p.containsRegex) > 0 || len(p.notContains) > 0
+}
+
+// matchesContent checks file content against the --contains and --not-contains expressions.
+// The content must match at least one --contains expression and none of the
+// --not-contains expressions.
+func (p *Processor) matchesContent(content []byte) bool {
+	for _, re := range p.notContains {
+		if re.Match(content) {
+			return false
+		}
+	}
+
+	if len(p.containsRegex) == 0 {
+		return true
+	}
+	for _, re := range p.containsRegex {
+		if re.Match(content) {
+			return true
+		}
+	}
+	return false
+}
+
 // processFile reads a file and writes its content to the output
 func (p *Processor) processFile(absPath, relPath string, writer io.Writer) error {
 	// Read the file content - we already checked it's a text file during initial scanning
-	content, err := os.ReadFile(absPath)
+	content, err := p.readFile(absPath, relPath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Convert Windows-style paths to Unix-style for consistency
-	relPath = filepath.ToSlash(relPath)
+	return p.formatter.File(writer, newEntry(relPath, content))
+}
 
-	// Write the file header
-	header := fmt.Sprintf("---\nFile: %s\n---\n\n", relPath)
-	if _, err := writer.Write([]byte(header)); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
+// estimateTokens estimates the number of tokens in the given text
+func (p *Processor) estimateTokens(text string) (int, error) {
+	tokenizer, err := p.loadedTokenizer()
+	if err != nil {
+		return 0, err
 	}
+	return p.cache.tokens(tokenizer, text, p.countTokens), nil
+}
 
-	// Write the file content
-	if _, err := writer.Write(content); err != nil {
-		return fmt.Errorf("failed to write content: %w", err)
+// loadedTokenizer loads the tokenizer and returns the name of the one in use
+func (p *Processor) loadedTokenizer() (string, error) {
+	p.tokenizerOnce.Do(p.loadTokenizer)
+	if p.tokenizerErr != nil {
+		return "", p.tokenizerErr
 	}
+	return p.tokenizer, nil
+}
 
-	// Add a newline after each file
-	if _, err := writer.Write([]byte("\n\n")); err != nil {
-		return fmt.Errorf("failed to write newline: %w", err)
+// isTextFile checks if a file is a text file by examining its content
+func isTextFile(filePath string) (bool, error) {
+	if hasTextFileName(filePath) {
+		// Known text file extension or name, skip binary check
+		return true, nil
 	}
 
-	return nil
-}
-
-// estimateTokens estimates the number of tokens in the given text
-func (p *Processor) estimateTokens(text string) (int, error) {
-	tkm, err := tiktoken.EncodingForModel("gpt-3.5-turbo")
+	// Read the first 512 bytes of the file to detect content type
+	file, err := os.Open(filePath)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get encoding: %w", err)
+		return false, fmt.Errorf("failed to open file for text detection: %w", err)
 	}
+	defer file.Close()
 
-	// Encode the text to tokens
-	tokens := tkm.Encode(text, nil, nil)
+	// Read a small chunk to check if it's a text file
+	// We'll use a 512-byte buffer, which should be enough to detect most binary files
+	buffer := make([]byte, 512)
+	n, err := file.Read(buffer)
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read file for text detection: %w", err)
+	}
 
-	return len(tokens), nil
+	return isTextContent(buffer[:n]), nil
 }
 
-// isTextFile checks if a file is a text file by examining its content
-func isTextFile(filePath string) (bool, error) {
+// hasTextFileName checks if a file name has a known text file extension or is a common
+// text file without an extension
+func hasTextFileName(filePath string) bool {
 	// Special handling for known text file extensions
 	knownTextExtensions := []string{
 		".go", ".js", ".ts", ".py", ".txt", ".md", ".html", ".css", ".json", ".xml", ".yaml", ".yml", ".toml",
@@ -382,8 +828,7 @@ func isTextFile(filePath string) (bool, error) {
 	ext := strings.ToLower(filepath.Ext(filePath))
 	for _, textExt := range knownTextExtensions {
 		if ext == textExt {
-			// Known text file extension, skip binary check
-			return true, nil
+			return true
 		}
 	}
 
@@ -396,32 +841,19 @@ func isTextFile(filePath string) (bool, error) {
 		}
 		for _, name := range noExtTextFiles {
 			if basename == name {
-				return true, nil
+				return true
 			}
 		}
 	}
 
-	// Read the first 512 bytes of the file to detect content type
-	file, err := os.Open(filePath)
-	if err != nil {
-		return false, fmt.Errorf("failed to open file for text detection: %w", err)
-	}
-	defer file.Close()
-
-	// Read a small chunk to check if it's a text file
-	// We'll use a 512-byte buffer, which should be enough to detect most binary files
-	buffer := make([]byte, 512)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return false, fmt.Errorf("failed to read file for text detection: %w", err)
-	}
-
-	// Reduce buffer to the number of bytes actually read
-	buffer = buffer[:n]
+	return false
+}
 
+// isTextContent checks if the leading bytes of a file look like text
+func isTextContent(buffer []byte) bool {
 	// Check for NULL bytes, which are a strong indicator of binary content
 	if bytes.IndexByte(buffer, 0) != -1 {
-		return false, nil
+		return false
 	}
 
 	// Check the ratio of control characters to printable characters
@@ -435,9 +867,9 @@ func isTextFile(filePath string) (bool, error) {
 	}
 
 	// Use a more permissive threshold (30% instead of 10%)
-	if n > 0 && float64(controlCount)/float64(n) > 0.3 {
-		return false, nil
+	if len(buffer) > 0 && float64(controlCount)/float64(len(buffer)) > 0.3 {
+		return false
 	}
 
-	return true, nil
+	return true
 }
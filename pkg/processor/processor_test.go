@@ -58,6 +58,22 @@ func cleanupTestDir(path string) {
 	os.RemoveAll(path)
 }
 
+// writeFiles writes files given by slash-separated paths relative to dir, creating
+// their parent directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
 // setupBinaryFile creates a simple binary file for testing
 func setupBinaryFile(t *testing.T, dir string) string {
 	// Create a binary file with some NULL bytes
@@ -107,6 +123,55 @@ func setupTestDirWithHiddenFiles(t *testing.T) string {
 	return tempDir
 }
 
+// runProcess runs Process with the given configuration and returns the captured stdout and stderr
+func runProcess(t *testing.T, config Config) (string, string) {
+	t.Helper()
+
+	processor, err := NewProcessor(config)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	// Capture stdout and stderr
+	oldStdout := os.Stdout
+	oldStderr := os.Stderr
+	stdoutR, stdoutW, _ := os.Pipe()
+	stderrR, stderrW, _ := os.Pipe()
+	os.Stdout = stdoutW
+	os.Stderr = stderrW
+
+	// Drain stderr concurrently so large warnings cannot block the pipe
+	stderrDone := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, stderrR)
+		stderrDone <- buf.String()
+	}()
+	stdoutDone := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, stdoutR)
+		stdoutDone <- buf.String()
+	}()
+
+	err = processor.Process()
+
+	// Close writers and restore stdout/stderr
+	stdoutW.Close()
+	stderrW.Close()
+	os.Stdout = oldStdout
+	os.Stderr = oldStderr
+
+	stdoutOutput := <-stdoutDone
+	stderrOutput := <-stderrDone
+
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	return stdoutOutput, stderrOutput
+}
+
 // TestNewProcessor tests the creation of a new processor
 func TestNewProcessor(t *testing.T) {
 	config := Config{
@@ -210,11 +275,10 @@ func TestGenerateDirectoryStructure(t *testing.T) {
 		t.Fatalf("Failed to create processor: %v", err)
 	}
 
-	structure := processor.generateDirectoryStructure(files)
+	structure := processor.generateDirectoryStructure(buildTree(files))
 
 	// Check that the structure contains expected elements
 	expectedElements := []string{
-		"Directory Structure:",
 		"./",
 		"dir1",
 		"subdir",
@@ -421,12 +485,17 @@ func TestEstimateTokens(t *testing.T) {
 		IncludeFiles: []string{"*.go"},
 		ExcludeFiles: []string{},
 		Output:       "-",
+		Tokenizer:    TokenizerCL100K,
 	}
 
 	processor, err := NewProcessor(config)
 	if err != nil {
 		t.Fatalf("Failed to create processor: %v", err)
 	}
+	// The encoding is downloaded on first use, which fails without network access
+	if _, err := processor.loadedTokenizer(); err != nil {
+		t.Skipf("Encoding is not available: %v", err)
+	}
 
 	testCases := []struct {
 		text     string
@@ -694,3 +763,72 @@ func TestExcludeHiddenAndGitFiles(t *testing.T) {
 		}
 	}
 }
+
+// TestShouldIncludeFileWithRegex tests path selection with regular expressions
+func TestShouldIncludeFileWithRegex(t *testing.T) {
+	processor, err := NewProcessor(Config{
+		DirPath:      ".",
+		IncludeFiles: []string{"*.md"},
+		IncludeRegex: []string{`^src/.*\.go$`},
+		ExcludeRegex: []string{`_gen\.go$`, `^docs/internal/`},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"src/main.go", true},
+		{"src/pkg/util.go", true},
+		{"src/pkg/types_gen.go", false},
+		{"cmd/main.go", false},
+		{"README.md", true},
+		{"docs/internal/notes.md", false},
+	}
+
+	for _, tc := range testCases {
+		if result := processor.shouldIncludeFile(tc.path); result != tc.expected {
+			t.Errorf("shouldIncludeFile(%s) = %v, want %v", tc.path, result, tc.expected)
+		}
+	}
+
+	if _, err := NewProcessor(Config{DirPath: ".", Contains: []string{"("}}); err == nil {
+		t.Error("Expected error for invalid regular expression, got nil")
+	}
+}
+
+// TestProcessWithContentFilters tests --contains and --not-contains selection
+func TestProcessWithContentFilters(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"dir1/payment.go":  "package dir1\n\ntype PaymentService struct{}\n",
+		"dir2/client.go":   "package dir2\n\nvar svc PaymentService // TODO: remove\n",
+		"dir2/payment.txt": "The payment service handles refunds.",
+	})
+
+	output, _ := runProcess(t, Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"*"},
+		Output:       "-",
+		Contains:     []string{`PaymentService`, `(?i)refund`},
+		NotContains:  []string{`TODO`},
+	})
+
+	expectedFiles := []string{"dir1/payment.go", "dir2/payment.txt"}
+	for _, file := range expectedFiles {
+		if !strings.Contains(output, "File: "+file) {
+			t.Errorf("Output missing expected file: %s", file)
+		}
+	}
+
+	unexpectedFiles := []string{"dir2/client.go", "file1.txt", "file2.go"}
+	for _, file := range unexpectedFiles {
+		if strings.Contains(output, "File: "+file) {
+			t.Errorf("Output contains unexpected file: %s", file)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// Formats of the token report
+const (
+	ReportTable = "table"
+	ReportJSON  = "json"
+)
+
+// validateReportFormat checks the format of the token report, empty for none
+func validateReportFormat(format string) error {
+	switch format {
+	case "", ReportTable, ReportJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid report format '%s': expected %s or %s", format, ReportTable, ReportJSON)
+}
+
+// reportRow is a file or a directory in the token report. Directories sum up all
+// files below them.
+type reportRow struct {
+	Path     string `json:"path"`
+	Language string `json:"language,omitempty"` // Language of a file, empty for directories
+	Files    int    `json:"files,omitempty"`
+	Size     int    `json:"size"`
+	Lines    int    `json:"lines"`
+	Tokens   int    `json:"tokens"`
+}
+
+// tokenReport lists what each included file and directory costs in the output
+type tokenReport struct {
+	Tokenizer    string      `json:"tokenizer"`
+	Files        []reportRow `json:"files"`
+	Directories  []reportRow `json:"directories"`
+	OutputTokens int         `json:"output_tokens,omitempty"` // Tokens of the whole output, 0 when not estimated
+}
+
+// buildReport measures the entries written for the matched files. Tokens include the
+// file header of the output format, so they add up to the cost of the files.
+func (p *Processor) buildReport(matchedFiles []string, plan *budgetPlan) (*tokenReport, error) {
+	report := &tokenReport{}
+	dirs := make(map[string]*reportRow)
+
+	var key string
+	if p.cache != nil && plan == nil {
+		var err error
+		if key, err = p.entryCacheKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	add := func(row reportRow) {
+		report.Files = append(report.Files, row)
+
+		// Roll the file up into every directory above it
+		for dir := path.Dir(row.Path); ; dir = path.Dir(dir) {
+			total, ok := dirs[dir]
+			if !ok {
+				total = &reportRow{Path: dir}
+				dirs[dir] = total
+			}
+			total.Files++
+			total.Size += row.Size
+			total.Lines += row.Lines
+			total.Tokens += row.Tokens
+			if dir == "." {
+				break
+			}
+		}
+	}
+
+	// measure returns the row of the entry written for a file
+	measure := func(e Entry) (reportRow, error) {
+		tokens, err := entryTokens(p.newFormatter, e, false, p.estimateTokens)
+		if err != nil {
+			return reportRow{}, err
+		}
+		return reportRow{Path: e.Path, Language: e.Language, Size: len(e.Content), Lines: lineCount(e.Content), Tokens: tokens}, nil
+	}
+
+	// Measure the entries as written, reading the files unless the plan holds them
+	if plan != nil {
+		for _, relPath := range matchedFiles {
+			if entry, ok := plan.entry(relPath); ok {
+				row, err := measure(entry)
+				if err != nil {
+					return nil, err
+				}
+				add(row)
+			}
+		}
+	} else {
+		// Files that did not change since an earlier run are taken from the cache
+		// without reading them
+		infos := make(map[string]os.FileInfo)
+		var unknown []string
+		for _, relPath := range matchedFiles {
+			absPath := filepath.Join(p.config.DirPath, relPath)
+			info, err := p.cacheStat(absPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to measure file %s: %w", relPath, err)
+			}
+			if info != nil {
+				slashPath := filepath.ToSlash(relPath)
+				m, ok, err := p.cache.measured(slashPath, info, hashFile(absPath), key)
+				if err != nil {
+					return nil, fmt.Errorf("failed to measure file %s: %w", relPath, err)
+				}
+				if ok {
+					add(reportRow{Path: slashPath, Language: m.Language, Size: int(info.Size()), Lines: m.Lines, Tokens: m.Tokens})
+					continue
+				}
+				infos[relPath] = info
+			}
+			unknown = append(unknown, relPath)
+		}
+
+		if err := p.readFiles(unknown, func(relPath string, content []byte) error {
+			row, err := measure(newEntry(relPath, content))
+			if err != nil {
+				return err
+			}
+			if info, ok := infos[relPath]; ok {
+				m := fileMeasure{Language: row.Language, Lines: row.Lines, Tokens: row.Tokens}
+				if err := p.cache.setMeasured(row.Path, info, hashOf(content), key, m); err != nil {
+					return fmt.Errorf("failed to measure file %s: %w", relPath, err)
+				}
+			}
+			add(row)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, total := range dirs {
+		report.Directories = append(report.Directories, *total)
+	}
+	sortReportRows(report.Files)
+	sortReportRows(report.Directories)
+	report.Tokenizer = p.tokenizer
+	return report, nil
+}
+
+// entryCacheKey returns the key the tokens of entries are cached under, naming the
+// tokenizer and the output format by the hash of a sample entry rendered with it
+func (p *Processor) entryCacheKey() (string, error) {
+	tokenizer, err := p.loadedTokenizer()
+	if err != nil {
+		return "", err
+	}
+	sample, err := renderDocument(p.newFormatter, Document{}, []Entry{newEntry("sample.txt", []byte("sample\n"))}, nil)
+	if err != nil {
+		return "", err
+	}
+	return tokenizer + ":" + contentHash([]byte(sample)), nil
+}
+
+// sortReportRows orders rows by token cost, the most expensive first
+func sortReportRows(rows []reportRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Tokens != rows[j].Tokens {
+			return rows[i].Tokens > rows[j].Tokens
+		}
+		return rows[i].Path < rows[j].Path
+	})
+}
+
+// write writes the report as a table or as JSON
+func (report *tokenReport) write(w io.Writer, format string) error {
+	if format == ReportJSON {
+		data, err := marshalJSON(report)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, data)
+		return err
+	}
+
+	var fileTokens int
+	for _, row := range report.Files {
+		fileTokens += row.Tokens
+	}
+	share := func(tokens int) string {
+		if fileTokens == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", float64(tokens)*100/float64(fileTokens))
+	}
+
+	fmt.Fprintf(w, "\nToken report (%s):\n\n", report.Tokenizer)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "TOKENS\tSHARE\tLINES\tBYTES\t\tFILE")
+	for _, row := range report.Files {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t\t%s\n", row.Tokens, share(row.Tokens), row.Lines, row.Size, row.Path)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "TOKENS\tSHARE\tLINES\tBYTES\tFILES\t\tDIRECTORY")
+	for _, row := range report.Directories {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t\t%s/\n", row.Tokens, share(row.Tokens), row.Lines, row.Size, row.Files, row.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if report.OutputTokens > 0 {
+		fmt.Fprintf(w, "\nEstimated tokens: %d (%s)\n", report.OutputTokens, report.Tokenizer)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setupReportDir creates files of clearly different sizes in nested directories
+func setupReportDir(t *testing.T) string {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"main.go":        "package main\n\nfunc main() {}\n",
+		"pkg/a/big.go":   strings.Repeat("var big = 1\n", 50),
+		"pkg/a/mid.go":   strings.Repeat("var mid = 1\n", 10),
+		"pkg/b/small.go": "package b\n",
+	})
+	return tempDir
+}
+
+// TestBuildReport tests the per-file rows and the rolled-up directory totals
+func TestBuildReport(t *testing.T) {
+	tempDir := setupReportDir(t)
+	p, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"**"}, Tokenizer: TokenizerWords})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	if p.formatter, err = p.newFormatter(); err != nil {
+		t.Fatalf("Failed to create formatter: %v", err)
+	}
+	matchedFiles, err := p.collectFiles()
+	if err != nil {
+		t.Fatalf("collectFiles error: %v", err)
+	}
+
+	report, err := p.buildReport(matchedFiles, nil)
+	if err != nil {
+		t.Fatalf("buildReport error: %v", err)
+	}
+
+	var files []string
+	for _, row := range report.Files {
+		files = append(files, row.Path)
+	}
+	if expected := []string{"pkg/a/big.go", "pkg/a/mid.go", "main.go", "pkg/b/small.go"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Files = %v, want %v", files, expected)
+	}
+	if big := report.Files[0]; big.Lines != 50 || big.Size != 600 {
+		t.Errorf("Unexpected row for big.go: %+v", big)
+	}
+
+	rows := make(map[string]reportRow)
+	var dirs []string
+	for _, row := range report.Directories {
+		rows[row.Path] = row
+		dirs = append(dirs, row.Path)
+	}
+	if expected := []string{".", "pkg", "pkg/a", "pkg/b"}; !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("Directories = %v, want %v", dirs, expected)
+	}
+	if a := rows["pkg/a"]; a.Files != 2 || a.Lines != 60 || a.Tokens != report.Files[0].Tokens+report.Files[1].Tokens {
+		t.Errorf("Unexpected row for pkg/a: %+v", a)
+	}
+	if root := rows["."]; root.Files != 4 || root.Tokens != rows["pkg"].Tokens+report.Files[2].Tokens {
+		t.Errorf("Unexpected row for the root: %+v", root)
+	}
+}
+
+// TestProcessWithReport tests the table and JSON reports written to stderr
+func TestProcessWithReport(t *testing.T) {
+	tempDir := setupReportDir(t)
+
+	_, stderr := runProcess(t, Config{
+		DirPath:        tempDir,
+		IncludeFiles:   []string{"**"},
+		Output:         "-",
+		EstimateTokens: true,
+		Tokenizer:      TokenizerWords,
+		Report:         ReportTable,
+	})
+	for _, expected := range []string{"Token report (words):", "FILE", "DIRECTORY", "pkg/a/big.go", "pkg/a/", "Estimated tokens:", "(words)\n"} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("Expected report to contain %q, got:\n%s", expected, stderr)
+		}
+	}
+	if strings.Index(stderr, "pkg/a/big.go") > strings.Index(stderr, "main.go") {
+		t.Errorf("Expected files sorted by tokens:\n%s", stderr)
+	}
+
+	_, stderr = runProcess(t, Config{
+		DirPath:        tempDir,
+		IncludeFiles:   []string{"**"},
+		Output:         "-",
+		EstimateTokens: true,
+		Tokenizer:      TokenizerWords,
+		Report:         ReportJSON,
+	})
+	var report tokenReport
+	if err := json.Unmarshal([]byte(stderr), &report); err != nil {
+		t.Fatalf("Report is not valid JSON: %v\n%s", err, stderr)
+	}
+	if len(report.Files) != 4 || len(report.Directories) != 4 || report.OutputTokens == 0 {
+		t.Errorf("Unexpected JSON report: %+v", report)
+	}
+}
+
+// TestInvalidReportFormat tests that unknown report formats are rejected
+func TestInvalidReportFormat(t *testing.T) {
+	if _, err := NewProcessor(Config{DirPath: ".", Report: "csv"}); err == nil {
+		t.Error("Expected error for an unknown report format")
+	}
+}
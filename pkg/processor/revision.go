@@ -0,0 +1,221 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// openRevisionTree opens the git repository containing DirPath, resolves the revision
+// and returns the tree object corresponding to DirPath at that revision
+func (p *Processor) openRevisionTree() (*object.Tree, error) {
+	absDir, err := filepath.Abs(p.config.DirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	repo, err := git.PlainOpenWithOptions(absDir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(p.config.Rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve revision '%s': %w", p.config.Rev, err)
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree of commit %s: %w", hash, err)
+	}
+
+	// Scanning a subdirectory of the repository reads the matching subtree
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+	prefix, err := filepath.Rel(worktree.Filesystem.Root(), absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relative path: %w", err)
+	}
+	prefix = filepath.ToSlash(prefix)
+	if prefix != "." {
+		tree, err = tree.Tree(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("directory %s does not exist at revision '%s': %w", prefix, p.config.Rev, err)
+		}
+	}
+
+	return tree, nil
+}
+
+// collectRevisionFiles enumerates the blobs of the revision tree and returns the
+// relative paths of all matching text files. It applies the same hidden file, prompt
+// ignore and include/exclude rules as the working tree walk; .gitignore does not
+// apply since every file in a commit is tracked.
+func (p *Processor) collectRevisionFiles() ([]string, error) {
+	tree, err := p.openRevisionTree()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*object.File
+	if err := tree.Files().ForEach(func(f *object.File) error {
+		files = append(files, f)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list files at revision '%s': %w", p.config.Rev, err)
+	}
+
+	// Load prompt ignore files from the outermost directory inwards so nested files take precedence
+	p.promptIgnore = newIgnoreMatcher()
+	p.promptInclude = newIgnoreMatcher()
+	var ignoreFiles []*object.File
+	for _, f := range files {
+		name := path.Base(f.Name)
+		if name == promptIgnoreFile || name == promptIncludeFile {
+			ignoreFiles = append(ignoreFiles, f)
+		}
+	}
+	sort.SliceStable(ignoreFiles, func(i, j int) bool {
+		return strings.Count(ignoreFiles[i].Name, "/") < strings.Count(ignoreFiles[j].Name, "/")
+	})
+	for _, f := range ignoreFiles {
+		content, err := f.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		matcher := p.promptIgnore
+		if path.Base(f.Name) == promptIncludeFile {
+			matcher = p.promptInclude
+		}
+		if err := matcher.AddPatterns(path.Dir(f.Name), strings.Split(content, "\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	p.revisionFiles = make(map[string]*object.File)
+	matchedFiles := []string{}
+	for _, f := range files {
+		relPath := f.Name
+
+		// Skip symbolic links
+		if f.Mode == filemode.Symlink {
+			continue
+		}
+
+		// Skip hidden files and files inside hidden or prompt-ignored directories
+		if isHiddenPath(relPath) || p.isPromptIgnoredDir(relPath) {
+			continue
+		}
+
+		if !p.isPromptSelected(relPath) || (p.skip != nil && p.skip(relPath, false)) {
+			continue
+		}
+		if p.config.TreeScope == TreeScopeAll {
+			p.treeFiles = append(p.treeFiles, filepath.FromSlash(relPath))
+		}
+		if !p.shouldIncludeFile(relPath) {
+			continue
+		}
+
+		isText, err := isRevisionTextFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if file is text: %w", err)
+		}
+		if !isText {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping binary file: %s\n", relPath)
+			continue
+		}
+
+		if p.hasContentFilters() {
+			content, err := f.Contents()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", relPath, err)
+			}
+			if !p.matchesContent([]byte(content)) {
+				continue
+			}
+		}
+
+		p.revisionFiles[relPath] = f
+		matchedFiles = append(matchedFiles, filepath.FromSlash(relPath))
+	}
+
+	return matchedFiles, nil
+}
+
+// isHiddenPath reports whether any component of a slash-separated path starts with '.'
+func isHiddenPath(relPath string) bool {
+	for _, part := range strings.Split(relPath, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isPromptIgnoredDir reports whether any parent directory of the path is ignored by a
+// .dir2promptignore file, which the working tree walk handles by skipping the directory
+func (p *Processor) isPromptIgnoredDir(relPath string) bool {
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if p.promptIgnore.Match(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRevisionTextFile checks if a blob is a text file by examining its name and content
+func isRevisionTextFile(f *object.File) (bool, error) {
+	if hasTextFileName(f.Name) {
+		return true, nil
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return isTextContent(buffer[:n]), nil
+}
+
+// readFile returns the content of a matched file, from the revision tree when --rev is
+// set and from disk otherwise
+func (p *Processor) readFile(absPath, relPath string) ([]byte, error) {
+	if p.revisionFiles == nil {
+		return os.ReadFile(absPath)
+	}
+
+	f, ok := p.revisionFiles[filepath.ToSlash(relPath)]
+	if !ok {
+		return nil, fmt.Errorf("file %s does not exist at revision '%s'", relPath, p.config.Rev)
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProcessWithRevision tests reading files from a git revision instead of the working tree
+func TestProcessWithRevision(t *testing.T) {
+	tempDir := setupGitRepo(t)
+	runGit(t, tempDir, "tag", "-a", "v1.0.0", "-m", "release")
+
+	// Second commit: modify, add and remove files
+	if err := os.WriteFile(filepath.Join(tempDir, "file1.txt"), []byte("Changed in second commit"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "dir1", "added.go"), []byte("package dir1\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "dir1", promptIgnoreFile), []byte("subdir/\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	runGit(t, tempDir, "rm", "-q", "dir2/file7.txt")
+	runGit(t, tempDir, "add", "-A")
+	runGit(t, tempDir, "commit", "-q", "-m", "second")
+
+	// Uncommitted working tree change must not show up
+	if err := os.WriteFile(filepath.Join(tempDir, "file1.txt"), []byte("Uncommitted change"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		dir           string
+		rev           string
+		expected      []string
+		unexpected    []string
+		expectedFiles []string
+		excludedFiles []string
+	}{
+		{
+			name:          "annotated tag",
+			dir:           tempDir,
+			rev:           "v1.0.0",
+			expected:      []string{"Content of file1.txt"},
+			unexpected:    []string{"Changed in second commit", "Uncommitted change"},
+			expectedFiles: []string{"file1.txt", "dir2/file7.txt", "dir1/subdir/file5.go"},
+			excludedFiles: []string{"dir1/added.go"},
+		},
+		{
+			name:          "head",
+			dir:           tempDir,
+			rev:           "HEAD",
+			expected:      []string{"Changed in second commit"},
+			unexpected:    []string{"Uncommitted change"},
+			expectedFiles: []string{"file1.txt", "dir1/added.go"},
+			excludedFiles: []string{"dir2/file7.txt", "dir1/subdir/file5.go"},
+		},
+		{
+			name:          "subdirectory at previous commit",
+			dir:           filepath.Join(tempDir, "dir1"),
+			rev:           "HEAD~1",
+			expectedFiles: []string{"file4.go", "subdir/file5.go"},
+			excludedFiles: []string{"added.go", "file1.txt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, _ := runProcess(t, Config{
+				DirPath:      tc.dir,
+				IncludeFiles: []string{"*"},
+				Output:       "-",
+				Rev:          tc.rev,
+			})
+
+			for _, s := range tc.expected {
+				if !strings.Contains(output, s) {
+					t.Errorf("Output missing expected content: %s", s)
+				}
+			}
+			for _, s := range tc.unexpected {
+				if strings.Contains(output, s) {
+					t.Errorf("Output contains unexpected content: %s", s)
+				}
+			}
+			for _, file := range tc.expectedFiles {
+				if !strings.Contains(output, "File: "+file+"\n") {
+					t.Errorf("Output missing expected file: %s", file)
+				}
+			}
+			for _, file := range tc.excludedFiles {
+				if strings.Contains(output, "File: "+file+"\n") {
+					t.Errorf("Output contains unexpected file: %s", file)
+				}
+			}
+		})
+	}
+}
+
+// TestProcessWithUnknownRevision tests that an unknown revision is reported
+func TestProcessWithUnknownRevision(t *testing.T) {
+	tempDir := setupGitRepo(t)
+
+	processor, err := NewProcessor(Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"*"},
+		Output:       filepath.Join(t.TempDir(), "out.txt"),
+		Rev:          "does-not-exist",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	if err := processor.Process(); err == nil || !strings.Contains(err.Error(), "failed to resolve revision") {
+		t.Errorf("Expected revision error, got: %v", err)
+	}
+}
+
+// TestProcessWithRevisionTreeScope tests showing every file of a revision in the tree
+func TestProcessWithRevisionTreeScope(t *testing.T) {
+	tempDir := setupGitRepo(t)
+
+	output, _ := runProcess(t, Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"*.go"},
+		Output:       "-",
+		Rev:          "HEAD",
+		TreeScope:    TreeScopeAll,
+	})
+	tree, _, _ := strings.Cut(output, "\n---\n")
+	if !strings.Contains(tree, "── file1.txt\n") || !strings.Contains(tree, "── file2.go [included]\n") {
+		t.Errorf("Expected all files of the revision in the tree, got:\n%s", tree)
+	}
+	if strings.Contains(output, "File: file1.txt") {
+		t.Errorf("Files outside the include patterns should not have content:\n%s", output)
+	}
+}
@@ -0,0 +1,526 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultServeAddr is the address the server listens on unless another one is given
+const DefaultServeAddr = "127.0.0.1:8080"
+
+// maxRequestBody limits the size of the configuration posted to /bundle
+const maxRequestBody = 1 << 20
+
+// contentTypes are the content types of the built-in output formats
+var contentTypes = map[string]string{
+	FormatText:     "text/plain; charset=utf-8",
+	FormatXML:      "application/xml; charset=utf-8",
+	FormatMarkdown: "text/markdown; charset=utf-8",
+	FormatJSON:     "application/json",
+	FormatJSONL:    "application/x-ndjson",
+}
+
+// Server exposes prompt generation for the directories below a root over HTTP:
+//
+//	POST /bundle          the output for a Config posted as JSON
+//	GET  /tree            the directory structure and the matched files
+//	GET  /file?path=      the content of a single file
+//	GET  /stats           the token report of the matched files
+//
+// Directories, files and templates must be located inside the root and must not be
+// hidden or ignored, so the server exposes no more than a scan of the root would.
+type Server struct {
+	root         string
+	defaults     Config // Settings of the server applied to every request
+	allowHistory bool   // Whether requests may read committed files with Rev and IncludeDiff
+	mux          *http.ServeMux
+
+	mu     sync.Mutex
+	caches map[string]*fileCache // Caches shared by the requests for a directory
+}
+
+// httpError is an error with the HTTP status it is reported with
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+// statusError returns an error reported with the given status
+func statusError(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// NewServer creates a server for the directories below root. CacheDir and
+// TokenizerData of defaults apply to every request and cannot be set by clients.
+// Unless allowHistory is set, requests cannot read committed files, which may
+// include files the working tree no longer has or now ignores.
+func NewServer(root string, defaults Config, allowHistory bool) (*Server, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root: %w", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open root: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("root %s is not a directory", root)
+	}
+
+	s := &Server{
+		root:         abs,
+		defaults:     Config{CacheDir: defaults.CacheDir, TokenizerData: defaults.TokenizerData},
+		allowHistory: allowHistory,
+		mux:          http.NewServeMux(),
+		caches:       make(map[string]*fileCache),
+	}
+	s.mux.HandleFunc("POST /bundle", s.handleBundle)
+	s.mux.HandleFunc("GET /tree", s.handleTree)
+	s.mux.HandleFunc("GET /file", s.handleFile)
+	s.mux.HandleFunc("GET /stats", s.handleStats)
+	return s, nil
+}
+
+// Serve listens on addr and serves the directories below root until ctx is done
+func Serve(ctx context.Context, addr, root string, defaults Config, allowHistory bool) error {
+	s, err := NewServer(root, defaults, allowHistory)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is reachable from other machines, which can read every file the server exposes\n", addr)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s (press Ctrl+C to stop)\n", s.root, listener.Addr())
+
+	server := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	if err := <-done; err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP rejects requests for host names other than localhost and IP addresses,
+// so web pages cannot reach the server through DNS rebinding
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host != "localhost" && !strings.HasSuffix(host, ".localhost") && net.ParseIP(host) == nil {
+		writeError(w, statusError(http.StatusForbidden, "host %q is not allowed, use localhost or an IP address", r.Host))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleBundle writes the output for the posted configuration
+func (s *Server) handleBundle(w http.ResponseWriter, r *http.Request) {
+	var config Config
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		writeError(w, statusError(http.StatusBadRequest, "invalid configuration: %v", err))
+		return
+	}
+
+	// The output is returned in the response, and the server decides where it caches and
+	// what it exposes
+	switch {
+	case config.Output != "" && config.Output != "-":
+		writeError(w, statusError(http.StatusBadRequest, "Output cannot be set, the output is returned in the response"))
+		return
+	case config.ChunkTokens > 0:
+		writeError(w, statusError(http.StatusBadRequest, "ChunkTokens cannot be set, chunked output is written to files"))
+		return
+	case config.Report != "":
+		writeError(w, statusError(http.StatusBadRequest, "Report cannot be set, use /stats for the token report"))
+		return
+	case config.CacheDir != "" || config.TokenizerData != "":
+		writeError(w, statusError(http.StatusBadRequest, "CacheDir and TokenizerData are settings of the server"))
+		return
+	case config.NoGitignore:
+		writeError(w, statusError(http.StatusBadRequest, "NoGitignore cannot be set, the server never exposes ignored files"))
+		return
+	case (config.Rev != "" || config.IncludeDiff) && !s.allowHistory:
+		// Committed files are not subject to the ignore rules of the working tree
+		writeError(w, statusError(http.StatusBadRequest, "Rev and IncludeDiff cannot be set, the server does not expose git history unless started with --allow-history"))
+		return
+	}
+	if config.Template != "" {
+		template, err := s.resolveFile(config.Template)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		config.Template = template
+	}
+	estimate := config.EstimateTokens
+	config.EstimateTokens = false
+
+	p, err := s.processor(config)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Buffer the output so failures are reported with a status and the estimate is
+	// known before the body is sent
+	var buf bytes.Buffer
+	p.stdout = &buf
+	if err := p.Process(); err != nil {
+		writeError(w, statusError(http.StatusInternalServerError, "%v", err))
+		return
+	}
+
+	contentType, ok := contentTypes[p.config.Format]
+	if !ok || p.template != nil {
+		contentType = contentTypes[FormatText]
+	}
+	w.Header().Set("Content-Type", contentType)
+	if estimate {
+		tokens, err := p.estimateTokens(buf.String())
+		if err != nil {
+			writeError(w, statusError(http.StatusInternalServerError, "failed to estimate tokens: %v", err))
+			return
+		}
+		w.Header().Set("X-Estimated-Tokens", fmt.Sprint(tokens))
+	}
+	w.Write(buf.Bytes())
+}
+
+// handleTree writes the directory structure and the matched files as JSON
+func (s *Server) handleTree(w http.ResponseWriter, r *http.Request) {
+	p, err := s.processor(queryConfig(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	matchedFiles, err := s.scan(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	files := make([]string, len(matchedFiles))
+	for i, relPath := range matchedFiles {
+		files[i] = filepath.ToSlash(relPath)
+	}
+	writeJSON(w, struct {
+		Root  string   `json:"root"`
+		Tree  string   `json:"tree"`
+		Files []string `json:"files"`
+	}{
+		Root:  filepath.Base(p.config.DirPath),
+		Tree:  p.generateDirectoryStructure(p.directoryTree(matchedFiles)),
+		Files: files,
+	})
+}
+
+// handleFile writes the content of a file that a scan of the root would consider
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	absPath, err := s.resolveFile(r.URL.Query().Get("path"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	text, err := isTextFile(absPath)
+	if err != nil {
+		writeError(w, statusError(http.StatusInternalServerError, "%v", err))
+		return
+	}
+	if !text {
+		writeError(w, statusError(http.StatusUnsupportedMediaType, "%s is not a text file", r.URL.Query().Get("path")))
+		return
+	}
+
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		writeError(w, statusError(http.StatusInternalServerError, "failed to read file: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", contentTypes[FormatText])
+	w.Write(content)
+}
+
+// handleStats writes the token report of the matched files as JSON
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	p, err := s.processor(queryConfig(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	matchedFiles, err := s.scan(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	report, err := p.buildReport(matchedFiles, nil)
+	if err != nil {
+		writeError(w, statusError(http.StatusInternalServerError, "failed to build token report: %v", err))
+		return
+	}
+	// Empty lists are encoded as arrays rather than null
+	if report.Files == nil {
+		report.Files, report.Directories = []reportRow{}, []reportRow{}
+	}
+	writeJSON(w, report)
+}
+
+// queryConfig reads the selection of /tree and /stats from the query. Lists may be
+// repeated or comma-separated like the command line flags.
+func queryConfig(r *http.Request) Config {
+	query := r.URL.Query()
+	list := func(name string) []string {
+		var values []string
+		for _, value := range query[name] {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values = append(values, item)
+				}
+			}
+		}
+		return values
+	}
+
+	return Config{
+		DirPath:      query.Get("dir"),
+		IncludeFiles: list("include"),
+		ExcludeFiles: list("exclude"),
+		Presets:      list("preset"),
+		ExcludeTests: query.Get("exclude_tests") == "true",
+		GlobMode:     query.Get("glob_mode"),
+		Tokenizer:    query.Get("tokenizer"),
+		Model:        query.Get("model"),
+		TreeScope:    query.Get("tree_scope"),
+	}
+}
+
+// processor creates the processor of a request. DirPath is relative to the root,
+// which it defaults to, and everything is included unless the request selects files.
+func (s *Server) processor(config Config) (*Processor, error) {
+	dir, err := s.resolve(config.DirPath, true)
+	if err != nil {
+		return nil, err
+	}
+	config.DirPath = dir
+
+	// A scan of a directory below the root applies the ignore files above it as well
+	var scope *Processor
+	prefix, err := filepath.Rel(s.root, dir)
+	if err != nil {
+		return nil, statusError(http.StatusInternalServerError, "%v", err)
+	}
+	if prefix = filepath.ToSlash(prefix); prefix != "." {
+		if scope, _, err = s.ignoreScope(prefix); err != nil {
+			return nil, statusError(http.StatusInternalServerError, "%v", err)
+		}
+	}
+
+	for _, ref := range []string{config.GitDiffRef, config.Rev} {
+		if strings.HasPrefix(ref, "-") {
+			return nil, statusError(http.StatusBadRequest, "invalid git ref %q", ref)
+		}
+	}
+	if len(config.IncludeFiles) == 0 && len(config.Presets) == 0 && len(config.IncludeRegex) == 0 {
+		config.IncludeFiles = []string{"*"}
+	}
+	config.Output = "-"
+	config.CacheDir = s.defaults.CacheDir
+	config.TokenizerData = s.defaults.TokenizerData
+
+	p, err := NewProcessor(config)
+	if err != nil {
+		return nil, statusError(http.StatusBadRequest, "%v", err)
+	}
+	if scope != nil {
+		p.skip = func(relPath string, isDir bool) bool {
+			return scope.isIgnoredPath(path.Join(prefix, filepath.ToSlash(relPath)), isDir)
+		}
+	}
+	if config.CacheDir != "" {
+		s.mu.Lock()
+		if s.caches[dir] == nil {
+			s.caches[dir] = loadCache(config.CacheDir, dir)
+		}
+		p.cache = s.caches[dir]
+		s.mu.Unlock()
+	}
+	return p, nil
+}
+
+// scan returns the sorted matched files of a request, saving the cache afterwards
+func (s *Server) scan(p *Processor) ([]string, error) {
+	defer func() {
+		if err := p.cache.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}()
+
+	matchedFiles, err := p.collectFiles()
+	if err != nil {
+		return nil, statusError(http.StatusInternalServerError, "%v", err)
+	}
+	sort.Strings(matchedFiles)
+	return matchedFiles, nil
+}
+
+// resolveFile returns the absolute path of a file given relative to the root
+func (s *Server) resolveFile(relPath string) (string, error) {
+	if relPath == "" {
+		return "", statusError(http.StatusBadRequest, "a file path is required")
+	}
+	return s.resolve(relPath, false)
+}
+
+// resolve returns the absolute path of a directory or file given relative to the
+// root. Paths escaping the root, also through symbolic links, are rejected, as are
+// paths a scan of the root would skip: hidden, gitignored and prompt-ignored ones.
+func (s *Server) resolve(relPath string, isDir bool) (string, error) {
+	slashed := strings.ReplaceAll(relPath, "\\", "/")
+	cleaned := path.Clean(slashed)
+	if path.IsAbs(slashed) || filepath.IsAbs(relPath) || filepath.VolumeName(relPath) != "" || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", statusError(http.StatusForbidden, "path %q must be relative to the root and stay inside it", relPath)
+	}
+	if cleaned != "." && isHiddenPath(cleaned) {
+		return "", statusError(http.StatusForbidden, "path %q is hidden", relPath)
+	}
+
+	absPath := filepath.Join(s.root, filepath.FromSlash(cleaned))
+	info, err := os.Lstat(absPath)
+	if os.IsNotExist(err) {
+		return "", statusError(http.StatusNotFound, "path %q does not exist", relPath)
+	} else if err != nil {
+		return "", statusError(http.StatusInternalServerError, "%v", err)
+	}
+	switch {
+	case isDir && !info.IsDir():
+		return "", statusError(http.StatusBadRequest, "path %q is not a directory", relPath)
+	case !isDir && !info.Mode().IsRegular():
+		return "", statusError(http.StatusBadRequest, "path %q is not a regular file", relPath)
+	}
+
+	if cleaned != "." {
+		if err := checkInside(s.root, filepath.Dir(absPath)); err != nil {
+			return "", statusError(http.StatusForbidden, "path %q resolves outside the root", relPath)
+		}
+		scope, ignored, err := s.ignoreScope(cleaned)
+		if err != nil {
+			return "", statusError(http.StatusInternalServerError, "%v", err)
+		}
+		if ignored || scope.isIgnoredPath(cleaned, isDir) {
+			return "", statusError(http.StatusForbidden, "path %q is ignored", relPath)
+		}
+	}
+	return absPath, nil
+}
+
+// ignoreScope returns a processor for the root holding the ignore files of the
+// directories above a path, as a walk of the root has loaded them when it reaches the
+// path, and whether one of these directories is ignored itself
+func (s *Server) ignoreScope(relPath string) (*Processor, bool, error) {
+	p := &Processor{config: Config{DirPath: s.root}}
+	matcher, base, err := loadGitignore(s.root)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load gitignore: %w", err)
+	}
+	p.gitignore, p.gitignoreBase = matcher, base
+	p.promptIgnore = newIgnoreMatcher()
+	p.promptInclude = newIgnoreMatcher()
+
+	parts := strings.Split(relPath, "/")
+	for i := 0; i < len(parts); i++ {
+		dir := "."
+		if i > 0 {
+			dir = path.Join(parts[:i]...)
+			if p.isIgnoredPath(dir, true) {
+				return p, true, nil
+			}
+		}
+
+		absDir := filepath.Join(s.root, filepath.FromSlash(dir))
+		if err := p.gitignore.AddFile(p.gitignorePath(dir), filepath.Join(absDir, ".gitignore")); err != nil {
+			return nil, false, err
+		}
+		if err := p.promptIgnore.AddFile(dir, filepath.Join(absDir, promptIgnoreFile)); err != nil {
+			return nil, false, err
+		}
+		if err := p.promptInclude.AddFile(dir, filepath.Join(absDir, promptIncludeFile)); err != nil {
+			return nil, false, err
+		}
+	}
+	return p, false, nil
+}
+
+// isIgnoredPath reports whether the .gitignore, .dir2promptignore or
+// .dir2promptinclude files loaded so far leave a path out of the scan
+func (p *Processor) isIgnoredPath(relPath string, isDir bool) bool {
+	if isDir {
+		return p.isGitignored(relPath, true) || p.promptIgnore.Match(relPath, true)
+	}
+	return p.isGitignored(relPath, false) || !p.isPromptSelected(relPath)
+}
+
+// writeJSON writes a value as the JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := marshalJSON(v)
+	if err != nil {
+		writeError(w, statusError(http.StatusInternalServerError, "%v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintln(w, data)
+}
+
+// writeError writes an error as a JSON response with its status, logging server errors
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+	if status >= http.StatusInternalServerError {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+
+	data, _ := marshalJSON(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, data)
+}
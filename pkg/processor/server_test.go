@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// setupServer serves a report directory with a hidden, an ignored and a binary file
+func setupServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	tempDir := setupReportDir(t)
+	writeFiles(t, tempDir, map[string]string{
+		".env":              "SECRET=1\n",
+		".gitignore":        "secret.txt\n",
+		"secret.txt":        "secret\n",
+		"image.bin":         "\x00\x01\x02",
+		"pkg/a/.hidden":     "hidden\n",
+		".dir2promptignore": "pkg/b/\n",
+	})
+
+	// Symbolic links to a directory and a file outside the root
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "outside.go"), []byte("package outside\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(tempDir, "link")); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "outside.go"), filepath.Join(tempDir, "alias.go")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	s, err := NewServer(tempDir, Config{CacheDir: t.TempDir()}, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server, tempDir
+}
+
+// request sends a request to the server and returns the status, headers and body
+func request(t *testing.T, method, url, body string) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return resp.StatusCode, resp.Header, string(data)
+}
+
+// TestServerBundle tests that /bundle returns the output of the posted configuration
+func TestServerBundle(t *testing.T) {
+	server, tempDir := setupServer(t)
+
+	status, header, body := request(t, "POST", server.URL+"/bundle", `{"IncludeFiles": ["**/*.go"], "Format": "json", "EstimateTokens": true, "Tokenizer": "words"}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", status, body)
+	}
+	expected, _ := runProcess(t, Config{DirPath: tempDir, IncludeFiles: []string{"**/*.go"}, Output: "-", Format: FormatJSON})
+	if body != expected {
+		t.Errorf("Expected the output of a run:\n%s\ngot:\n%s", expected, body)
+	}
+	if header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected content type %q", header.Get("Content-Type"))
+	}
+	if tokens, _ := strconv.Atoi(header.Get("X-Estimated-Tokens")); tokens != countWordTokens(body) {
+		t.Errorf("Expected %d estimated tokens, got %q", countWordTokens(body), header.Get("X-Estimated-Tokens"))
+	}
+
+	// Directories are relative to the root and everything is included by default
+	status, _, body = request(t, "POST", server.URL+"/bundle", `{"DirPath": "pkg/a"}`)
+	if status != http.StatusOK || !strings.Contains(body, "File: big.go") || strings.Contains(body, "main.go") {
+		t.Errorf("Expected the output of pkg/a, got %d:\n%s", status, body)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid JSON", `{"IncludeFiles": `, http.StatusBadRequest},
+		{"unknown field", `{"Include": ["*"]}`, http.StatusBadRequest},
+		{"output file", `{"Output": "out.txt"}`, http.StatusBadRequest},
+		{"chunks", `{"ChunkTokens": 100}`, http.StatusBadRequest},
+		{"cache directory", `{"CacheDir": "/tmp"}`, http.StatusBadRequest},
+		{"ignored files", `{"NoGitignore": true}`, http.StatusBadRequest},
+		{"invalid pattern", `{"IncludeFiles": ["["]}`, http.StatusBadRequest},
+		{"option as ref", `{"GitDiffRef": "--output=x"}`, http.StatusBadRequest},
+		{"escaping directory", `{"DirPath": ".."}`, http.StatusForbidden},
+		{"absolute directory", `{"DirPath": "` + filepath.ToSlash(tempDir) + `"}`, http.StatusForbidden},
+		{"ignored directory", `{"DirPath": "pkg/b"}`, http.StatusForbidden},
+		{"missing directory", `{"DirPath": "missing"}`, http.StatusNotFound},
+		{"linked directory", `{"DirPath": "link"}`, http.StatusBadRequest},
+		{"hidden template", `{"Template": ".env"}`, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		status, _, body := request(t, "POST", server.URL+"/bundle", test.body)
+		if status != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.status, status, body)
+		}
+		if !strings.Contains(body, `"error"`) {
+			t.Errorf("%s: expected a JSON error, got %s", test.name, body)
+		}
+	}
+}
+
+// TestServerHistory tests that committed files are only exposed when the server allows it
+func TestServerHistory(t *testing.T) {
+	tempDir := setupGitRepo(t)
+	if err := os.WriteFile(filepath.Join(tempDir, "keys.txt"), []byte("API_KEY=hunter2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, tempDir, "add", "-A")
+	runGit(t, tempDir, "commit", "-q", "-m", "add keys")
+	if err := os.Remove(filepath.Join(tempDir, "keys.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, ".dir2promptignore"), []byte("keys.txt\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, tempDir, "add", "-A")
+	runGit(t, tempDir, "commit", "-q", "-m", "remove keys")
+
+	for _, allowHistory := range []bool{false, true} {
+		s, err := NewServer(tempDir, Config{}, allowHistory)
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		tests := []struct {
+			body   string
+			status int
+		}{
+			{`{"Rev": "HEAD~1"}`, http.StatusBadRequest},
+			{`{"GitDiffRef": "HEAD~2", "IncludeDiff": true}`, http.StatusBadRequest},
+			{`{"GitDiffRef": "HEAD~2"}`, http.StatusOK},
+		}
+		for _, test := range tests {
+			status := test.status
+			if allowHistory {
+				status = http.StatusOK
+			}
+			got, _, body := request(t, "POST", server.URL+"/bundle", test.body)
+			if got != status {
+				t.Errorf("%s with allowHistory %v: expected status %d, got %d: %s", test.body, allowHistory, status, got, body)
+			}
+			if leaked := strings.Contains(body, "hunter2"); leaked != (allowHistory && test.body == `{"Rev": "HEAD~1"}`) {
+				t.Errorf("%s with allowHistory %v: unexpected output:\n%s", test.body, allowHistory, body)
+			}
+		}
+	}
+}
+
+// TestServerTreeAndStats tests the directory structure and the token report
+func TestServerTreeAndStats(t *testing.T) {
+	server, _ := setupServer(t)
+
+	status, _, body := request(t, "GET", server.URL+"/tree?include=**/*.go&exclude=main.go", "")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", status, body)
+	}
+	var tree struct {
+		Tree  string   `json:"tree"`
+		Files []string `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(body), &tree); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, body)
+	}
+	if strings.Join(tree.Files, ",") != "pkg/a/big.go,pkg/a/mid.go" || !strings.Contains(tree.Tree, "big.go") {
+		t.Errorf("Unexpected tree: %+v", tree)
+	}
+
+	// The .dir2promptignore of the root also applies to a scan of pkg
+	status, _, body = request(t, "GET", server.URL+"/stats?dir=pkg&tokenizer=words", "")
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", status, body)
+	}
+	var report tokenReport
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, body)
+	}
+	if report.Tokenizer != TokenizerWords || len(report.Files) != 2 || report.Files[0].Path != "a/big.go" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if status, _, body := request(t, "GET", server.URL+"/stats?tokenizer=unknown", ""); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown tokenizer, got %d: %s", status, body)
+	}
+}
+
+// TestServerFile tests that /file only serves text files a scan would consider
+func TestServerFile(t *testing.T) {
+	server, _ := setupServer(t)
+
+	status, _, body := request(t, "GET", server.URL+"/file?path=pkg/a/mid.go", "")
+	if status != http.StatusOK || body != strings.Repeat("var mid = 1\n", 10) {
+		t.Errorf("Expected the file content, got %d: %s", status, body)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"", http.StatusBadRequest},
+		{"pkg", http.StatusBadRequest},
+		{"missing.go", http.StatusNotFound},
+		{"../main.go", http.StatusForbidden},
+		{"pkg/../../main.go", http.StatusForbidden},
+		{"/etc/passwd", http.StatusForbidden},
+		{".env", http.StatusForbidden},
+		{"pkg/a/.hidden", http.StatusForbidden},
+		{"secret.txt", http.StatusForbidden},
+		{"pkg/b/small.go", http.StatusForbidden},
+		{"image.bin", http.StatusUnsupportedMediaType},
+		{"link/outside.go", http.StatusForbidden},
+		{"alias.go", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if status, _, body := request(t, "GET", server.URL+"/file?path="+test.path, ""); status != test.status {
+			t.Errorf("%q: expected status %d, got %d: %s", test.path, test.status, status, body)
+		}
+	}
+}
+
+// TestServerRejectsForeignHosts tests the protection against DNS rebinding
+func TestServerRejectsForeignHosts(t *testing.T) {
+	s, err := NewServer(setupReportDir(t), Config{}, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		host   string
+		status int
+	}{
+		{"localhost:8080", http.StatusOK},
+		{"127.0.0.1:8080", http.StatusOK},
+		{"[::1]:8080", http.StatusOK},
+		{"app.localhost", http.StatusOK},
+		{"attacker.example.com", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/tree", nil)
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.host, test.status, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is the data model passed to a --template. A template renders the whole
+// output, or a whole chunk when the output is split.
+type TemplateData struct {
+	Root   string         // Name of the scanned directory
+	Tree   string         // Directory tree rendered as text, empty when omitted from a chunk
+	Nodes  []*TreeNode    // Top-level nodes of the directory tree
+	Files  []TemplateFile // Files in output order
+	Diff   *TemplateDiff  // Git diff with --include-diff, nil otherwise
+	Chunk  int            // 1-based chunk number, 0 when the output is not split
+	Chunks int            // Total number of chunks
+	Totals TemplateTotals
+}
+
+// TemplateFile is a file, or a part of a file, in the template data. The fields of
+// Entry (Path, Content, Language, Size, Mode, Part, Parts, FirstLine, LastLine) are
+// available directly, e.g. {{.Path}}.
+type TemplateFile struct {
+	Entry
+	Lines  int // Number of lines in Content
+	Tokens int // Estimated tokens of Content
+}
+
+// TemplateDiff is the git diff in the template data
+type TemplateDiff struct {
+	Description string // Compared revisions, e.g. "changes since main"
+	Content     string
+}
+
+// TemplateTotals sums up the files in the template data
+type TemplateTotals struct {
+	Files  int
+	Size   int // Bytes of the complete files
+	Lines  int
+	Tokens int
+}
+
+// templateFuncs are the functions available to templates in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"replace":   strings.ReplaceAll,
+	"join":      strings.Join,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"base":      filepath.Base,
+	"ext":       filepath.Ext,
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"fence": func(language, content string) string {
+		return strings.TrimSuffix(fenced(content, language), "\n")
+	},
+	"xml":   xmlEscape,
+	"cdata": cdata,
+	"json": func(v interface{}) (string, error) {
+		return marshalJSON(v)
+	},
+}
+
+// loadTemplate reads and parses a template file
+func loadTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateFormatter collects the document and renders it with a user template in End
+type templateFormatter struct {
+	tmpl  *template.Template
+	count func(string) (int, error)
+	data  TemplateData
+}
+
+func newTemplateFormatter(tmpl *template.Template, count func(string) (int, error)) *templateFormatter {
+	return &templateFormatter{tmpl: tmpl, count: count}
+}
+
+func (f *templateFormatter) Begin(w io.Writer, doc Document) error {
+	f.data.Root = doc.Root
+	f.data.Tree = doc.Tree
+	f.data.Nodes = doc.Nodes
+	f.data.Chunk = doc.Chunk
+	f.data.Chunks = doc.Chunks
+	return nil
+}
+
+func (f *templateFormatter) File(w io.Writer, e Entry) error {
+	tokens, err := f.count(e.Content)
+	if err != nil {
+		return err
+	}
+
+	file := TemplateFile{Entry: e, Lines: lineCount(e.Content), Tokens: tokens}
+	f.data.Files = append(f.data.Files, file)
+	f.data.Totals.Files++
+	f.data.Totals.Size += file.Size
+	f.data.Totals.Lines += file.Lines
+	f.data.Totals.Tokens += file.Tokens
+	return nil
+}
+
+func (f *templateFormatter) Diff(w io.Writer, e Entry) error {
+	f.data.Diff = &TemplateDiff{Description: e.Path, Content: e.Content}
+	return nil
+}
+
+func (f *templateFormatter) End(w io.Writer) error {
+	if err := f.tmpl.Execute(w, f.data); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+	return nil
+}
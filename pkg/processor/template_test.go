@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTemplateFormatter tests rendering the data model with a user template
+func TestTemplateFormatter(t *testing.T) {
+	tempDir := t.TempDir()
+	templatePath := filepath.Join(tempDir, "prompt.tmpl")
+	template := `Project {{.Root}} ({{.Totals.Files}} files, {{.Totals.Lines}} lines, {{.Totals.Tokens}} tokens)
+{{range .Nodes}}[{{.Name}}{{if .IsDir}}/{{end}}]{{end}}
+{{range .Files}}<file path="{{xml .Path}}" lang="{{.Language}}" tokens="{{.Tokens}}">
+{{.Content}}</file>
+{{end}}{{with .Diff}}DIFF {{.Description}}: {{trim .Content}}{{end}}`
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	tmpl, err := loadTemplate(templatePath)
+	if err != nil {
+		t.Fatalf("loadTemplate() error: %v", err)
+	}
+
+	files := []string{"cmd/root.go", "main.go"}
+	doc := Document{Root: "project", Tree: "tree\n", Nodes: buildTree(files).Children}
+	entries := []Entry{
+		newEntry("cmd/root.go", []byte("package cmd\n")),
+		newEntry("main.go", []byte("package main\n\nfunc main() {}\n")),
+	}
+	diff := &Entry{Path: "staged changes", Content: "+func main() {}\n"}
+
+	output, err := renderDocument(func() (Formatter, error) {
+		return newTemplateFormatter(tmpl, countWords), nil
+	}, doc, entries, diff)
+	if err != nil {
+		t.Fatalf("renderDocument() error: %v", err)
+	}
+
+	expected := `Project project (2 files, 4 lines, 7 tokens)
+[cmd/][main.go]
+<file path="cmd/root.go" lang="go" tokens="2">
+package cmd
+</file>
+<file path="main.go" lang="go" tokens="5">
+package main
+
+func main() {}
+</file>
+DIFF staged changes: +func main() {}`
+	if output != expected {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", output, expected)
+	}
+}
+
+// TestTemplateErrors tests that template problems are reported
+func TestTemplateErrors(t *testing.T) {
+	tempDir := t.TempDir()
+
+	if _, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"*"}, Template: filepath.Join(tempDir, "missing.tmpl")}); err == nil {
+		t.Error("Expected error for missing template")
+	}
+
+	broken := filepath.Join(tempDir, "broken.tmpl")
+	if err := os.WriteFile(broken, []byte("{{range .Files}"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if _, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"*"}, Template: broken}); err == nil || !strings.Contains(err.Error(), "parse template") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+
+	unknownField := filepath.Join(tempDir, "field.tmpl")
+	if err := os.WriteFile(unknownField, []byte("{{.Missing}}"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	tmpl, err := loadTemplate(unknownField)
+	if err != nil {
+		t.Fatalf("loadTemplate() error: %v", err)
+	}
+	if _, err := renderDocument(func() (Formatter, error) {
+		return newTemplateFormatter(tmpl, countWords), nil
+	}, Document{}, nil, nil); err == nil {
+		t.Error("Expected error for unknown field")
+	}
+}
@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"bytes"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// segmentSize is the amount of output collected before a segment is counted
+const segmentSize = 64 << 10
+
+// tokenCounter counts the tokens of everything written to it without holding the whole
+// text. The text is only cut into segments at a newline between a non-space character
+// and a letter or digit. The pre-tokenizers of the BPE encodings and the word heuristic
+// never join such a newline with its neighbors, so the counts of the segments add up to
+// the count of the text. Segments are counted concurrently, and cached when the
+// processor has a cache.
+type tokenCounter struct {
+	count   func(string) int // Counts a segment
+	finish  func(int) int    // Turns the summed counts into tokens
+	segment int              // Size at which pending text is cut into a segment
+	pending []byte           // Text written since the last cut
+	workers chan struct{}    // Limits the segments counted at once
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	total   int
+}
+
+// newTokenCounter creates a counter for the tokenizer of the processor
+func (p *Processor) newTokenCounter() (*tokenCounter, error) {
+	tokenizer, err := p.loadedTokenizer()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tokenCounter{
+		count: func(segment string) int {
+			return p.cache.tokens(tokenizer, segment, p.countTokens)
+		},
+		finish:  func(n int) int { return n },
+		segment: segmentSize,
+		workers: make(chan struct{}, p.workers()),
+	}
+	// Characters are only rounded to tokens once the whole text has been counted
+	if tokenizer == TokenizerChars {
+		c.count, c.finish = utf8.RuneCountInString, func(n int) int { return (n + 3) / 4 }
+	}
+	return c, nil
+}
+
+// Write adds text to the counter, counting the complete segments in the background
+func (c *tokenCounter) Write(b []byte) (int, error) {
+	c.pending = append(c.pending, b...)
+	if len(c.pending) < c.segment {
+		return len(b), nil
+	}
+
+	c.cut()
+	return len(b), nil
+}
+
+// cut counts the pending text up to its last possible cut, in segments of at most the
+// segment size where the text allows it, so a large file written at once is not
+// counted as a whole. Cutting before every file keeps the segments of unchanged files
+// the same between runs, so their counts are found in the cache.
+func (c *tokenCounter) cut() {
+	if c == nil {
+		return
+	}
+	start := 0
+	for {
+		rest := c.pending[start:]
+		cut := 0
+		if len(rest) > c.segment {
+			cut = lastCut(rest[:c.segment])
+		}
+		if cut == 0 {
+			cut = lastCut(rest)
+		}
+		if cut == 0 {
+			break
+		}
+		c.add(string(rest[:cut]))
+		start += cut
+	}
+	c.pending = append(c.pending[:0], c.pending[start:]...)
+}
+
+// add counts a segment on one of the workers
+func (c *tokenCounter) add(segment string) {
+	c.workers <- struct{}{}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		n := c.count(segment)
+		<-c.workers
+
+		c.mu.Lock()
+		c.total += n
+		c.mu.Unlock()
+	}()
+}
+
+// tokens counts the remaining text and returns the tokens of everything written
+func (c *tokenCounter) tokens() int {
+	if len(c.pending) > 0 {
+		c.add(string(c.pending))
+		c.pending = nil
+	}
+	c.wg.Wait()
+	return c.finish(c.total)
+}
+
+// lastCut returns the position after the last newline in text that follows a non-space
+// character and is followed by a letter or digit, or 0 if there is none
+func lastCut(text []byte) int {
+	for end := len(text); ; {
+		i := bytes.LastIndexByte(text[:end], '\n')
+		if i <= 0 {
+			return 0
+		}
+		before, _ := utf8.DecodeLastRune(text[:i])
+		after, _ := utf8.DecodeRune(text[i+1:])
+		if before != utf8.RuneError && !unicode.IsSpace(before) && (unicode.IsLetter(after) || unicode.IsDigit(after)) {
+			return i + 1
+		}
+		end = i
+	}
+}
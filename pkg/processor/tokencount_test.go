@@ -0,0 +1,232 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// bpePatterns are the pre-tokenizer patterns of the BPE encodings in tiktoken-go
+var bpePatterns = map[string]string{
+	TokenizerCL100K: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	TokenizerO200K: strings.Join([]string{
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`\p{N}{1,3}`,
+		` ?[^\s\p{L}\p{N}]+[\r\n/]*`,
+		`\s*[\r\n]+`,
+		`\s+(?!\S)`,
+		`\s+`,
+	}, "|"),
+	TokenizerR50K: `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
+}
+
+// newTestEncoding creates a small byte-level BPE encoding with the pre-tokenizer of a
+// real encoding. Encodings are built directly since tiktoken caches them by name.
+func newTestEncoding(t *testing.T, name string) func(string) int {
+	t.Helper()
+
+	ranks := make(map[string]int)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for _, merge := range []string{"fu", "nc", "func", "in", "ing", " t", "he", " the", "  ", "    ", "\n\n", "}\n", "re", "turn", "return"} {
+		ranks[merge] = len(ranks)
+	}
+	special := map[string]int{tiktoken.ENDOFTEXT: len(ranks)}
+
+	bpe, err := tiktoken.NewCoreBPE(ranks, special, bpePatterns[name])
+	if err != nil {
+		t.Fatalf("Failed to create encoding %s: %v", name, err)
+	}
+	tkm := tiktoken.NewTiktoken(bpe, &tiktoken.Encoding{Name: name, PatStr: bpePatterns[name], MergeableRanks: ranks, SpecialTokens: special}, map[string]any{tiktoken.ENDOFTEXT: true})
+	return func(text string) int {
+		return len(tkm.Encode(text, nil, nil))
+	}
+}
+
+// tokenCountText returns an output with the constructs that pre-tokenizers merge
+// across lines: blank lines, indentation, CRLF, punctuation before slashes,
+// contractions, digits, marks and non-Latin scripts
+func tokenCountText(t *testing.T) string {
+	t.Helper()
+
+	stdout, _ := runProcess(t, Config{DirPath: setupReportDir(t), IncludeFiles: []string{"**"}, Output: "-"})
+	var sb strings.Builder
+	sb.WriteString(stdout)
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&sb, "func f%d() {\n    return %d\n}\n/// comment's\r\n\n\n  \n%d items\n", i, i*1000, i)
+		sb.WriteString("}\n/path\nÉtoile ÿ é\n日本語のテキスト\n٣٤ numbers\n'quoted' it's\n<|endoftext|>\n\t\ttabs\n \n")
+	}
+	return sb.String()
+}
+
+// TestLastCut tests where the text is cut into segments
+func TestLastCut(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"no newline", 0},
+		{"line\nnext", 5},
+		{"one\ntwo\nthree", 8},
+		{"line\n\nnext", 0},
+		{"line \nnext", 0},
+		{"\nnext", 0},
+		{"line\n  indented", 0},
+		{"}\n/path", 0},
+		{"line\n", 0},
+		{"line\n7 items", 5},
+		{"line\nétoile\n ", 5},
+		{"line\r\nnext", 0},
+		{"}\nnext\n\n", 2},
+	}
+
+	for _, test := range tests {
+		if got := lastCut([]byte(test.text)); got != test.expected {
+			t.Errorf("lastCut(%q) = %d, want %d", test.text, got, test.expected)
+		}
+	}
+}
+
+// TestTokenCounterMatchesWholeText tests that counting in segments gives the count of
+// the whole text for every tokenizer, whatever the segment size and write sizes
+func TestTokenCounterMatchesWholeText(t *testing.T) {
+	text := tokenCountText(t)
+
+	counters := map[string]func(string) int{
+		TokenizerWords: countWordTokens,
+	}
+	for name := range bpePatterns {
+		counters[name] = newTestEncoding(t, name)
+	}
+
+	for _, segment := range []int{1, 7, 100, 4096, segmentSize} {
+		for _, writeSize := range []int{1, 13, 1000, len(text)} {
+			for name, count := range counters {
+				c := &tokenCounter{count: count, finish: func(n int) int { return n }, segment: segment, workers: make(chan struct{}, 4)}
+				writeInPieces(c, text, writeSize)
+				if got, expected := c.tokens(), count(text); got != expected {
+					t.Errorf("%s, segment %d, writes of %d: counted %d tokens, want %d", name, segment, writeSize, got, expected)
+				}
+			}
+
+			p, err := NewProcessor(Config{DirPath: ".", Tokenizer: TokenizerChars})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			c, err := p.newTokenCounter()
+			if err != nil {
+				t.Fatalf("newTokenCounter error: %v", err)
+			}
+			c.segment = segment
+			writeInPieces(c, text, writeSize)
+			if got, expected := c.tokens(), countCharTokens(text); got != expected {
+				t.Errorf("chars, segment %d, writes of %d: counted %d tokens, want %d", segment, writeSize, got, expected)
+			}
+		}
+	}
+}
+
+// writeInPieces writes text to the counter in pieces of the given size
+func writeInPieces(c *tokenCounter, text string, size int) {
+	for start := 0; start < len(text); start += size {
+		end := start + size
+		if end > len(text) {
+			end = len(text)
+		}
+		c.Write([]byte(text[start:end]))
+	}
+}
+
+// TestProcessTokenCount tests that the estimate of a run is the count of the whole output
+func TestProcessTokenCount(t *testing.T) {
+	tempDir := setupSyntheticTree(t, t.TempDir(), 500)
+	output := filepath.Join(t.TempDir(), "output.txt")
+
+	for _, tokenizer := range []string{TokenizerWords, TokenizerChars} {
+		_, stderr := runProcess(t, Config{DirPath: tempDir, IncludeFiles: []string{"**"}, Output: output, EstimateTokens: true, Tokenizer: tokenizer})
+
+		match := regexp.MustCompile(`Estimated tokens: (\d+)`).FindStringSubmatch(stderr)
+		if match == nil {
+			t.Fatalf("%s: expected a token estimate, got:\n%s", tokenizer, stderr)
+		}
+		content, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		if len(content) < 2*segmentSize {
+			t.Fatalf("Output of %d bytes is too small to be counted in segments", len(content))
+		}
+
+		expected := heuristicTokenizers[tokenizer](string(content))
+		if got, _ := strconv.Atoi(match[1]); got != expected {
+			t.Errorf("%s: estimated %d tokens, want %d", tokenizer, got, expected)
+		}
+	}
+}
+
+// TestProcessMemoryBounded tests that a default run holds about one file per job in memory
+func TestProcessMemoryBounded(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping memory test in short mode")
+	}
+
+	const files, fileSize, jobs = 32, 1 << 20, 2
+	tempDir := t.TempDir()
+	line := "func value() int { return 42 } // the quick brown fox\n"
+	content := strings.Repeat(line, fileSize/len(line))
+	for i := 0; i < files; i++ {
+		data := content
+		if i == 0 {
+			// A header collision makes the default boundary hash every file
+			data = "---\nFile: main.go\n---\n\n" + content
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, fmt.Sprintf("file%d.go", i)), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	output := filepath.Join(t.TempDir(), "output.txt")
+
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	base, peak := stats.HeapInuse, stats.HeapInuse
+
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > peak {
+				peak = stats.HeapInuse
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+	_, stderr := runProcess(t, Config{DirPath: tempDir, IncludeFiles: []string{"*"}, Output: output, EstimateTokens: true, Tokenizer: TokenizerWords, Jobs: jobs})
+	close(done)
+	<-sampled
+
+	if !strings.Contains(stderr, "looks like a file header") {
+		t.Fatalf("Expected a boundary, got:\n%s", stderr)
+	}
+	// A few copies of each file in flight, far less than the files together
+	if grown, limit := peak-base, uint64(8<<20+8*jobs*fileSize); grown > limit {
+		t.Errorf("Heap grew by %d MB for %d files of %d MB, want at most %d MB", grown>>20, files, fileSize>>20, limit>>20)
+	}
+}
@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Tokenizers used to estimate tokens. The BPE encodings are exact for OpenAI models and
+// need their .tiktoken data, the heuristics need no data.
+const (
+	TokenizerCL100K = "cl100k_base"
+	TokenizerO200K  = "o200k_base"
+	TokenizerP50K   = "p50k_base"
+	TokenizerR50K   = "r50k_base"
+	// TokenizerChars estimates one token per four characters
+	TokenizerChars = "chars"
+	// TokenizerWords counts words and punctuation marks
+	TokenizerWords = "words"
+)
+
+// defaultTokenizer is the encoding of gpt-3.5-turbo and gpt-4
+const defaultTokenizer = TokenizerCL100K
+
+// heuristicTokenizers count tokens without encoding data
+var heuristicTokenizers = map[string]func(string) int{
+	TokenizerChars: countCharTokens,
+	TokenizerWords: countWordTokens,
+}
+
+// wordPattern matches a word or a single punctuation mark
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}_]+|[^\s\p{L}\p{N}_]`)
+
+// countCharTokens estimates tokens as a quarter of the characters, rounded up
+func countCharTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// countWordTokens estimates tokens as the number of words and punctuation marks
+func countWordTokens(text string) int {
+	return len(wordPattern.FindAllStringIndex(text, -1))
+}
+
+// TokenizerNames returns the names of the supported tokenizers
+func TokenizerNames() []string {
+	return []string{TokenizerCL100K, TokenizerO200K, TokenizerP50K, TokenizerR50K, TokenizerChars, TokenizerWords}
+}
+
+// resolveTokenizer returns the tokenizer selected by name or model
+func resolveTokenizer(name, model string) (string, error) {
+	if name != "" && model != "" {
+		return "", fmt.Errorf("tokenizer and model are mutually exclusive")
+	}
+	if model != "" {
+		return encodingForModel(model)
+	}
+	if name == "" {
+		return defaultTokenizer, nil
+	}
+	for _, known := range TokenizerNames() {
+		if name == known {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown tokenizer '%s' (available: %s)", name, strings.Join(TokenizerNames(), ", "))
+}
+
+// encodingForModel returns the encoding of an OpenAI model, matching the longest
+// model name prefix for dated versions
+func encodingForModel(model string) (string, error) {
+	if encoding, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return encoding, nil
+	}
+
+	prefixes := make([]string, 0, len(tiktoken.MODEL_PREFIX_TO_ENCODING))
+	for prefix := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(model, prefix) {
+			return tiktoken.MODEL_PREFIX_TO_ENCODING[prefix], nil
+		}
+	}
+	return "", fmt.Errorf("unknown model '%s': choose an encoding or heuristic with the tokenizer option instead", model)
+}
+
+// loadTokenizer prepares the token counter on first use. Without an explicit choice,
+// an encoding that cannot be loaded, e.g. on an air-gapped machine, falls back to
+// the chars heuristic with a warning.
+func (p *Processor) loadTokenizer() {
+	if count, ok := heuristicTokenizers[p.tokenizer]; ok {
+		p.countTokens = count
+		return
+	}
+
+	tkm, err := loadEncoding(p.tokenizer, p.config.TokenizerData)
+	if err != nil {
+		if p.config.Tokenizer != "" || p.config.Model != "" || p.config.TokenizerData != "" {
+			p.tokenizerErr = fmt.Errorf("failed to load tokenizer %s: %w", p.tokenizer, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Warning: failed to load tokenizer %s, estimating tokens from characters instead: %v\n", p.tokenizer, err)
+		p.tokenizer, p.countTokens = TokenizerChars, countCharTokens
+		return
+	}
+
+	p.countTokens = func(text string) int {
+		return len(tkm.Encode(text, nil, nil))
+	}
+}
+
+// tiktokenMutex guards the global BPE loader of tiktoken
+var tiktokenMutex sync.Mutex
+
+// loadEncoding loads a BPE encoding, reading its data from dataDir if it is set and
+// from the tiktoken cache or the network otherwise
+func loadEncoding(name, dataDir string) (*tiktoken.Tiktoken, error) {
+	tiktokenMutex.Lock()
+	defer tiktokenMutex.Unlock()
+
+	if dataDir != "" {
+		tiktoken.SetBpeLoader(&dirBpeLoader{dir: dataDir})
+		defer tiktoken.SetBpeLoader(tiktoken.NewDefaultBpeLoader())
+	}
+	return tiktoken.GetEncoding(name)
+}
+
+// dirBpeLoader loads BPE ranks from .tiktoken files in a local directory, named like
+// the files published by OpenAI, e.g. cl100k_base.tiktoken
+type dirBpeLoader struct {
+	dir string
+}
+
+func (l *dirBpeLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	file := filepath.Join(l.dir, path.Base(url))
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer data: %w", err)
+	}
+
+	ranks := make(map[string]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		encoded, rank, ok := strings.Cut(line, " ")
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid tokenizer data in %s on line %d", file, i+1)
+		}
+		if ranks[string(token)], err = strconv.Atoi(strings.TrimSpace(rank)); err != nil {
+			return nil, fmt.Errorf("invalid tokenizer data in %s on line %d", file, i+1)
+		}
+	}
+	return ranks, nil
+}
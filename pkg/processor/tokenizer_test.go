@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// TestHeuristicTokenizers tests the estimators that need no encoding data
+func TestHeuristicTokenizers(t *testing.T) {
+	testCases := []struct {
+		tokenizer string
+		text      string
+		expected  int
+	}{
+		{TokenizerChars, "", 0},
+		{TokenizerChars, "Hello, world!", 4},
+		{TokenizerChars, "héllo", 2},
+		{TokenizerWords, "", 0},
+		{TokenizerWords, "Hello, world!", 4},
+		{TokenizerWords, "This is a longer text with multiple tokens that should be counted.", 13},
+		{TokenizerWords, "x := foo_bar(42)", 7},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tokenizer+" "+tc.text, func(t *testing.T) {
+			p, err := NewProcessor(Config{DirPath: ".", Tokenizer: tc.tokenizer})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			count, err := p.estimateTokens(tc.text)
+			if err != nil {
+				t.Fatalf("estimateTokens error: %v", err)
+			}
+			if count != tc.expected {
+				t.Errorf("estimateTokens(%q) = %d, want %d", tc.text, count, tc.expected)
+			}
+		})
+	}
+}
+
+// TestResolveTokenizer tests selecting a tokenizer by name or model
+func TestResolveTokenizer(t *testing.T) {
+	testCases := []struct {
+		name      string
+		model     string
+		expected  string
+		expectErr bool
+	}{
+		{"", "", TokenizerCL100K, false},
+		{TokenizerO200K, "", TokenizerO200K, false},
+		{TokenizerWords, "", TokenizerWords, false},
+		{"gpt2", "", "", true},
+		{"", "gpt-3.5-turbo", TokenizerCL100K, false},
+		{"", "gpt-4-0613", TokenizerCL100K, false},
+		{"", "gpt-4o", TokenizerO200K, false},
+		{"", "gpt-4o-2024-05-13", TokenizerO200K, false},
+		{"", "text-davinci-003", TokenizerP50K, false},
+		{"", "claude-3", "", true},
+		{TokenizerChars, "gpt-4o", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name+"/"+tc.model, func(t *testing.T) {
+			tokenizer, err := resolveTokenizer(tc.name, tc.model)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %s", tokenizer)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveTokenizer error: %v", err)
+			}
+			if tokenizer != tc.expected {
+				t.Errorf("resolveTokenizer(%q, %q) = %s, want %s", tc.name, tc.model, tokenizer, tc.expected)
+			}
+		})
+	}
+
+	if _, err := NewProcessor(Config{DirPath: ".", Tokenizer: "unknown"}); err == nil {
+		t.Error("Expected NewProcessor to reject an unknown tokenizer")
+	}
+}
+
+// TestDirBpeLoader tests reading encoding data from a local directory
+func TestDirBpeLoader(t *testing.T) {
+	dir := t.TempDir()
+	data := "IQ== 0\nIg== 1\naGVsbG8= 2\n"
+	if err := os.WriteFile(filepath.Join(dir, "test_base.tiktoken"), []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.tiktoken"), []byte("IQ== zero\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	loader := &dirBpeLoader{dir: dir}
+	ranks, err := loader.LoadTiktokenBpe("https://example.com/encodings/test_base.tiktoken")
+	if err != nil {
+		t.Fatalf("LoadTiktokenBpe error: %v", err)
+	}
+	if len(ranks) != 3 || ranks["!"] != 0 || ranks["\""] != 1 || ranks["hello"] != 2 {
+		t.Errorf("Unexpected ranks: %v", ranks)
+	}
+
+	if _, err := loader.LoadTiktokenBpe("https://example.com/encodings/broken.tiktoken"); err == nil {
+		t.Error("Expected error for invalid data")
+	}
+	if _, err := loader.LoadTiktokenBpe("https://example.com/encodings/missing.tiktoken"); err == nil {
+		t.Error("Expected error for missing data")
+	}
+}
+
+// TestProcessWithHeuristicTokenizer tests token estimation without encoding data
+func TestProcessWithHeuristicTokenizer(t *testing.T) {
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	_, stderr := runProcess(t, Config{
+		DirPath:        tempDir,
+		IncludeFiles:   []string{"*.txt"},
+		Output:         "-",
+		EstimateTokens: true,
+		Tokenizer:      TokenizerChars,
+	})
+	if !regexp.MustCompile(`Estimated tokens: \d+ \(chars\)`).MatchString(stderr) {
+		t.Errorf("Expected token estimate naming the tokenizer, got: %s", stderr)
+	}
+	if strings.Contains(stderr, "Warning") {
+		t.Errorf("Unexpected warning: %s", stderr)
+	}
+}
+
+// TestMissingTokenizerData tests that an explicitly chosen encoding does not fall back
+func TestMissingTokenizerData(t *testing.T) {
+	p, err := NewProcessor(Config{DirPath: ".", Tokenizer: TokenizerR50K, TokenizerData: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+	if _, err := p.estimateTokens("hello"); err == nil {
+		t.Error("Expected error for missing tokenizer data")
+	}
+}
+
+// TestDefaultTokenizerFallback tests that only the default encoding falls back to the
+// chars heuristic when it cannot be loaded, and that the estimate names the heuristic
+func TestDefaultTokenizerFallback(t *testing.T) {
+	tiktokenMutex.Lock()
+	tiktoken.SetBpeLoader(&dirBpeLoader{dir: t.TempDir()})
+	tiktokenMutex.Unlock()
+	t.Cleanup(func() {
+		tiktokenMutex.Lock()
+		tiktoken.SetBpeLoader(tiktoken.NewDefaultBpeLoader())
+		tiktokenMutex.Unlock()
+	})
+	if _, err := loadEncoding(defaultTokenizer, ""); err == nil {
+		t.Skip("The default encoding was already loaded by an earlier test")
+	}
+
+	tempDir := setupTestDir(t)
+	defer cleanupTestDir(tempDir)
+
+	_, stderr := runProcess(t, Config{DirPath: tempDir, IncludeFiles: []string{"*.txt"}, Output: "-", EstimateTokens: true})
+	if !strings.Contains(stderr, "Warning: failed to load tokenizer cl100k_base") {
+		t.Errorf("Expected a fallback warning, got: %s", stderr)
+	}
+	if !regexp.MustCompile(`Estimated tokens: \d+ \(chars\)`).MatchString(stderr) {
+		t.Errorf("Expected the estimate to name the chars heuristic, got: %s", stderr)
+	}
+
+	for _, config := range []Config{
+		{DirPath: ".", Tokenizer: TokenizerCL100K},
+		{DirPath: ".", Model: "gpt-4"},
+	} {
+		p, err := NewProcessor(config)
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+		if _, err := p.estimateTokens("hello"); err == nil {
+			t.Errorf("Expected error for explicitly chosen encoding %+v", config)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package processor
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files shown in the directory tree
+const (
+	// TreeScopeMatched shows the files included with their content
+	TreeScopeMatched = "matched"
+	// TreeScopeAll shows every file that is not ignored, marking the included ones
+	TreeScopeAll = "all"
+)
+
+// includedMarker follows the files included with their content when the tree shows all files
+const includedMarker = " [included]"
+
+// Metrics shown next to the nodes of the directory tree
+const (
+	AnnotateSize   = "size"
+	AnnotateLines  = "lines"
+	AnnotateTokens = "tokens"
+)
+
+// TreeNode is a file or directory in the directory tree of the matched files
+type TreeNode struct {
+	Name     string      // Base name, "./" for the root
+	Path     string      // Slash-separated path relative to the scanned directory, "" for the root
+	IsDir    bool        // Whether the node is a directory
+	Included bool        // Whether the file, or any file below the directory, is included with its content
+	Children []*TreeNode // Directories first, then files, each sorted by name
+	Size     int         // Bytes of the file, or of all files below a directory
+	Lines    int         // Lines of the file, or of all files below a directory
+	Tokens   int         // Estimated tokens of the file content, or of all files below a directory
+}
+
+// buildTree builds the directory tree of the given relative file paths
+func buildTree(files []string) *TreeNode {
+	root := &TreeNode{Name: "./", IsDir: true}
+	index := map[string]*TreeNode{"": root}
+
+	for _, file := range files {
+		// Convert backslashes to forward slashes for consistency
+		parts := strings.Split(filepath.ToSlash(file), "/")
+
+		current := root
+		for i, part := range parts {
+			path := strings.Join(parts[:i+1], "/")
+			node, exists := index[path]
+			if !exists {
+				node = &TreeNode{Name: part, Path: path, IsDir: i < len(parts)-1}
+				index[path] = node
+				current.Children = append(current.Children, node)
+			}
+			current = node
+		}
+	}
+
+	sortTree(root)
+	return root
+}
+
+// sortTree sorts the children of every node, directories first, then by name
+func sortTree(node *TreeNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir // Directories come first
+		}
+		return a.Name < b.Name // Alphabetical order
+	})
+	for _, child := range node.Children {
+		sortTree(child)
+	}
+}
+
+// validateTreeScope checks the scope of the directory tree, empty for matched
+func validateTreeScope(scope string) error {
+	switch scope {
+	case "", TreeScopeMatched, TreeScopeAll:
+		return nil
+	}
+	return fmt.Errorf("invalid tree scope '%s': expected %s or %s", scope, TreeScopeMatched, TreeScopeAll)
+}
+
+// directoryTree builds the tree shown in the output: the matched files, or every file
+// that is not ignored with the tree scope all, minus the files hidden by TreeExclude
+func (p *Processor) directoryTree(matchedFiles []string) *TreeNode {
+	files := matchedFiles
+	if p.config.TreeScope == TreeScopeAll {
+		files = p.treeFiles
+	}
+
+	shown := make([]string, 0, len(files))
+	for _, relPath := range files {
+		if !p.isTreeExcluded(relPath) {
+			shown = append(shown, relPath)
+		}
+	}
+
+	root := buildTree(shown)
+	index := make(map[string]*TreeNode)
+	var walk func(node *TreeNode)
+	walk = func(node *TreeNode) {
+		index[node.Path] = node
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	// Mark the included files and every directory above them
+	for _, relPath := range matchedFiles {
+		slashPath := filepath.ToSlash(relPath)
+		if _, ok := index[slashPath]; !ok {
+			continue // Hidden from the tree
+		}
+		for dir := slashPath; dir != "."; dir = path.Dir(dir) {
+			index[dir].Included = true
+		}
+		root.Included = true
+	}
+	return root
+}
+
+// isTreeExcluded reports whether a file is hidden from the directory tree
+func (p *Processor) isTreeExcluded(relPath string) bool {
+	for _, matcher := range p.treeExclude {
+		if matcher.Match(relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// treeMarker returns the marker of a file included with its content when the tree
+// also shows files without content
+func (p *Processor) treeMarker(node *TreeNode) string {
+	if p.config.TreeScope == TreeScopeAll && !node.IsDir && node.Included {
+		return includedMarker
+	}
+	return ""
+}
+
+// validateTreeAnnotations checks the metrics requested for the directory tree
+func validateTreeAnnotations(annotations []string) error {
+	for _, annotation := range annotations {
+		switch annotation {
+		case AnnotateSize, AnnotateLines, AnnotateTokens:
+		default:
+			return fmt.Errorf("invalid tree annotation '%s': expected %s, %s or %s", annotation, AnnotateSize, AnnotateLines, AnnotateTokens)
+		}
+	}
+	return nil
+}
+
+// annotateTree measures every included file in the tree and sums the metrics up into
+// the directories above it. Tokens are only estimated when they are shown.
+func (p *Processor) annotateTree(node *TreeNode) error {
+	if !node.Included {
+		return nil
+	}
+	if !node.IsDir {
+		return p.measureFile(node)
+	}
+
+	for _, child := range node.Children {
+		if err := p.annotateTree(child); err != nil {
+			return err
+		}
+		node.Size += child.Size
+		node.Lines += child.Lines
+		node.Tokens += child.Tokens
+	}
+	return nil
+}
+
+// measureFile sets the size, lines and, if they are shown, the tokens of a file node.
+// Files of the working tree that did not change since an earlier run are not read.
+func (p *Processor) measureFile(node *TreeNode) error {
+	var tokenizer string
+	for _, annotation := range p.config.TreeAnnotate {
+		if annotation == AnnotateTokens {
+			var err error
+			if tokenizer, err = p.loadedTokenizer(); err != nil {
+				return err
+			}
+		}
+	}
+
+	path := filepath.Join(p.config.DirPath, filepath.FromSlash(node.Path))
+	info, err := p.cacheStat(path)
+	if err != nil {
+		return fmt.Errorf("failed to measure file %s: %w", node.Path, err)
+	}
+	if info != nil {
+		m, ok, err := p.cache.measured(node.Path, info, hashFile(path), tokenizer)
+		if err != nil {
+			return fmt.Errorf("failed to measure file %s: %w", node.Path, err)
+		}
+		if ok {
+			node.Size, node.Lines, node.Tokens = int(info.Size()), m.Lines, m.Tokens
+			return nil
+		}
+	}
+
+	content, err := p.readFile(path, node.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", node.Path, err)
+	}
+	node.Size = len(content)
+	node.Lines = lineCount(string(content))
+	if tokenizer != "" {
+		if node.Tokens, err = p.estimateTokens(string(content)); err != nil {
+			return err
+		}
+	}
+	if info != nil {
+		m := fileMeasure{Language: languageOf(node.Path), Lines: node.Lines, Tokens: node.Tokens}
+		if err := p.cache.setMeasured(node.Path, info, hashOf(content), tokenizer, m); err != nil {
+			return fmt.Errorf("failed to measure file %s: %w", node.Path, err)
+		}
+	}
+	return nil
+}
+
+// treeAnnotation returns the details shown after the name of a node, such as
+// " (1.2 KB, 40 lines)": the given summaries followed by the metrics of included
+// content. It returns an empty string if there is nothing to show.
+func (p *Processor) treeAnnotation(node *TreeNode, summaries ...string) string {
+	metrics := summaries
+	if node.Included {
+		for _, annotation := range p.config.TreeAnnotate {
+			switch annotation {
+			case AnnotateSize:
+				metrics = append(metrics, formatSize(node.Size))
+			case AnnotateLines:
+				metrics = append(metrics, plural(node.Lines, "line"))
+			case AnnotateTokens:
+				metrics = append(metrics, plural(node.Tokens, "token"))
+			}
+		}
+	}
+	if len(metrics) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(metrics, ", ") + ")"
+}
+
+// isCollapsed reports whether a directory is listed without its contents: below the
+// maximum depth, or when it has more entries than allowed and they are all files of
+// the same type
+func (p *Processor) isCollapsed(node *TreeNode, depth int) bool {
+	if !node.IsDir || len(node.Children) == 0 {
+		return false
+	}
+	if p.config.TreeMaxDepth > 0 && depth >= p.config.TreeMaxDepth {
+		return true
+	}
+	if p.config.TreeMaxChildren > 0 && len(node.Children) > p.config.TreeMaxChildren {
+		ext := path.Ext(node.Children[0].Name)
+		for _, child := range node.Children {
+			if child.IsDir || ext == "" || path.Ext(child.Name) != ext {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// summarizeFiles describes the files below a collapsed directory, such as
+// "140 *.json files" when they share an extension or "12 files" otherwise
+func summarizeFiles(node *TreeNode) string {
+	var files []*TreeNode
+	var walk func(node *TreeNode)
+	walk = func(node *TreeNode) {
+		for _, child := range node.Children {
+			if child.IsDir {
+				walk(child)
+			} else {
+				files = append(files, child)
+			}
+		}
+	}
+	walk(node)
+
+	ext := path.Ext(files[0].Name)
+	for _, file := range files {
+		if path.Ext(file.Name) != ext {
+			ext = ""
+			break
+		}
+	}
+	if ext == "" {
+		return plural(len(files), "file")
+	}
+	return plural(len(files), "*"+ext+" file")
+}
+
+// summarizeHidden describes the entries left out of a directory listing, such as
+// "2 more directories and 312 more files"
+func summarizeHidden(hidden []*TreeNode) string {
+	dirs := 0
+	for _, node := range hidden {
+		if node.IsDir {
+			dirs++
+		}
+	}
+
+	var parts []string
+	if dirs > 0 {
+		parts = append(parts, plural(dirs, "more directory"))
+	}
+	if files := len(hidden) - dirs; files > 0 {
+		parts = append(parts, plural(files, "more file"))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// plural formats a count with a singular noun, e.g. "1 file" or "2 files"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "y") {
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(noun, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatSize formats a number of bytes for humans, e.g. 512 B or 1.2 KB
+func formatSize(size int) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	}
+}
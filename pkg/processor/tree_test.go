@@ -0,0 +1,262 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestBuildTree tests building the directory tree from relative paths
+func TestBuildTree(t *testing.T) {
+	root := buildTree([]string{"main.go", "pkg/b.go", "pkg/sub/c.go", "README.md", "pkg/a.go"})
+
+	var walk func(node *TreeNode) []string
+	walk = func(node *TreeNode) []string {
+		var paths []string
+		for _, child := range node.Children {
+			entry := child.Path
+			if child.IsDir {
+				entry += "/"
+			}
+			paths = append(paths, entry)
+			paths = append(paths, walk(child)...)
+		}
+		return paths
+	}
+
+	expected := []string{"pkg/", "pkg/sub/", "pkg/sub/c.go", "pkg/a.go", "pkg/b.go", "README.md", "main.go"}
+	result := walk(root)
+	if len(result) != len(expected) {
+		t.Fatalf("buildTree() = %v, want %v", result, expected)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Errorf("buildTree() = %v, want %v", result, expected)
+			break
+		}
+	}
+
+	if root.Name != "./" || !root.IsDir || root.Path != "" {
+		t.Errorf("Unexpected root node: %+v", root)
+	}
+}
+
+// TestAnnotateTree tests the metrics of files and the totals of directories
+func TestAnnotateTree(t *testing.T) {
+	tempDir := setupReportDir(t)
+	p, err := NewProcessor(Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"**"},
+		Tokenizer:    TokenizerWords,
+		TreeAnnotate: []string{AnnotateLines, AnnotateSize, AnnotateTokens},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	root := p.directoryTree([]string{"main.go", "pkg/a/big.go", "pkg/a/mid.go", "pkg/b/small.go"})
+	if err := p.annotateTree(root); err != nil {
+		t.Fatalf("annotateTree error: %v", err)
+	}
+	if root.Size != 759 || root.Lines != 64 || root.Tokens != 250 {
+		t.Errorf("Unexpected root totals: %+v", root)
+	}
+
+	tree := p.generateDirectoryStructure(root)
+	for _, expected := range []string{
+		"└── ./ (64 lines, 759 B, 250 tokens)\n",
+		"├── pkg (61 lines, 730 B, 242 tokens)\n",
+		"│   ├── a (60 lines, 720 B, 240 tokens)\n",
+		"│   │   ├── big.go (50 lines, 600 B, 200 tokens)\n",
+		"│       └── small.go (1 line, 10 B, 2 tokens)\n",
+		"└── main.go (3 lines, 29 B, 8 tokens)\n",
+	} {
+		if !strings.Contains(tree, expected) {
+			t.Errorf("Expected tree to contain %q, got:\n%s", expected, tree)
+		}
+	}
+}
+
+// TestFormatSize tests the human-readable sizes of tree annotations
+func TestFormatSize(t *testing.T) {
+	testCases := map[int]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KB",
+		1536:            "1.5 KB",
+		5 * 1024 * 1024: "5.0 MB",
+	}
+	for size, expected := range testCases {
+		if result := formatSize(size); result != expected {
+			t.Errorf("formatSize(%d) = %s, want %s", size, result, expected)
+		}
+	}
+}
+
+// TestInvalidTreeAnnotation tests that unknown metrics are rejected
+func TestInvalidTreeAnnotation(t *testing.T) {
+	if _, err := NewProcessor(Config{DirPath: ".", TreeAnnotate: []string{"size", "words"}}); err == nil {
+		t.Error("Expected error for an unknown tree annotation")
+	}
+}
+
+// TestProcessWithTreeAnnotations tests that every output format shows the annotated tree
+func TestProcessWithTreeAnnotations(t *testing.T) {
+	tempDir := setupReportDir(t)
+
+	for _, format := range FormatNames() {
+		t.Run(format, func(t *testing.T) {
+			stdout, _ := runProcess(t, Config{
+				DirPath:      tempDir,
+				IncludeFiles: []string{"**"},
+				Output:       "-",
+				Format:       format,
+				TreeAnnotate: []string{AnnotateSize, AnnotateLines},
+			})
+			if !strings.Contains(stdout, "big.go (600 B, 50 lines)") {
+				t.Errorf("Expected annotated tree, got:\n%s", stdout)
+			}
+		})
+	}
+}
+
+// TestProcessWithTreeScope tests showing every file in the tree while including only a subset
+func TestProcessWithTreeScope(t *testing.T) {
+	tempDir := setupReportDir(t)
+	setupBinaryFile(t, tempDir)
+
+	stdout, _ := runProcess(t, Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"pkg/a/*"},
+		Output:       "-",
+		TreeScope:    TreeScopeAll,
+		TreeExclude:  []string{"mid.go"},
+	})
+
+	for _, expected := range []string{
+		"├── pkg\n",
+		"│   ├── a\n",
+		"│   │   └── big.go [included]\n",
+		"│   └── b\n",
+		"│       └── small.go\n",
+		"├── binary.bin\n",
+		"└── main.go\n",
+		"File: pkg/a/big.go",
+		"File: pkg/a/mid.go",
+	} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, stdout)
+		}
+	}
+	if strings.Contains(stdout, "── mid.go") || strings.Contains(stdout, "File: main.go") {
+		t.Errorf("Unexpected tree or content:\n%s", stdout)
+	}
+
+	// The default scope only shows the included files
+	stdout, _ = runProcess(t, Config{
+		DirPath:      tempDir,
+		IncludeFiles: []string{"pkg/a/*"},
+		Output:       "-",
+		TreeExclude:  []string{"mid.go"},
+	})
+	if strings.Contains(stdout, "main.go") || strings.Contains(stdout, "[included]") || !strings.Contains(stdout, "    └── big.go\n") {
+		t.Errorf("Unexpected tree for the matched scope:\n%s", stdout)
+	}
+}
+
+// TestInvalidTreeScope tests that unknown tree scopes are rejected
+func TestInvalidTreeScope(t *testing.T) {
+	if _, err := NewProcessor(Config{DirPath: ".", TreeScope: "everything"}); err == nil {
+		t.Error("Expected error for an unknown tree scope")
+	}
+}
+
+// TestTreeLimits tests limiting the depth and the entries per directory of the tree
+func TestTreeLimits(t *testing.T) {
+	files := []string{"main.go", "go.mod", "README.md", "pkg/a/a.go", "pkg/a/b.go", "pkg/c.go", "docs/guide.md", "docs/img/logo.png"}
+	for i := 0; i < 5; i++ {
+		files = append(files, fmt.Sprintf("testdata/case%d.json", i))
+	}
+
+	testCases := []struct {
+		name        string
+		maxDepth    int
+		maxChildren int
+		expected    string
+	}{
+		{
+			name:     "max depth",
+			maxDepth: 1,
+			expected: "└── ./\n" +
+				"├── docs/ (2 files)\n" +
+				"├── pkg/ (3 *.go files)\n" +
+				"├── testdata/ (5 *.json files)\n" +
+				"├── README.md\n" +
+				"├── go.mod\n" +
+				"└── main.go\n",
+		},
+		{
+			name:        "max children",
+			maxChildren: 4,
+			expected: "└── ./\n" +
+				"├── docs\n" +
+				"│   ├── img\n" +
+				"│   │   └── logo.png\n" +
+				"│   └── guide.md\n" +
+				"├── pkg\n" +
+				"│   ├── a\n" +
+				"│   │   ├── a.go\n" +
+				"│   │   └── b.go\n" +
+				"│   └── c.go\n" +
+				"├── testdata/ (5 *.json files)\n" +
+				"├── README.md\n" +
+				"└── … 2 more files\n",
+		},
+		{
+			name:        "mixed overflow",
+			maxDepth:    2,
+			maxChildren: 1,
+			expected: "└── ./\n" +
+				"├── docs\n" +
+				"│   ├── img/ (1 *.png file)\n" +
+				"│   └── … 1 more file\n" +
+				"└── … 2 more directories and 3 more files\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewProcessor(Config{DirPath: ".", TreeMaxDepth: tc.maxDepth, TreeMaxChildren: tc.maxChildren})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+			if tree := p.generateDirectoryStructure(buildTree(files)); tree != tc.expected {
+				t.Errorf("Unexpected tree:\n%s\nwant:\n%s", tree, tc.expected)
+			}
+		})
+	}
+
+	if _, err := NewProcessor(Config{DirPath: ".", TreeMaxDepth: -1}); err == nil {
+		t.Error("Expected error for a negative tree limit")
+	}
+}
+
+// TestProcessWithoutTree tests omitting the directory structure
+func TestProcessWithoutTree(t *testing.T) {
+	tempDir := setupReportDir(t)
+
+	for _, format := range FormatNames() {
+		t.Run(format, func(t *testing.T) {
+			stdout, _ := runProcess(t, Config{
+				DirPath:      tempDir,
+				IncludeFiles: []string{"**"},
+				Output:       "-",
+				Format:       format,
+				NoTree:       true,
+			})
+			if strings.Contains(stdout, "── ") || !strings.Contains(stdout, "var big = 1") {
+				t.Errorf("Expected files without a directory structure, got:\n%s", stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BundleFile is a file restored from dir2prompt output
+type BundleFile struct {
+	Path    string
+	Content string
+	Skipped string // Why the file cannot be restored, e.g. its content was omitted; empty otherwise
+}
+
+var (
+	// textHeaderPattern matches a section header of the classic text format
+	textHeaderPattern = regexp.MustCompile(`(?m)^---\n(File|Git Diff): (.*)\n(?:Part: (\d+) of (\d+), lines \d+-\d+\n)?---\n\n`)
+	// partPattern matches the part line of a section header
+	partPattern = regexp.MustCompile(`^Part: (\d+) of (\d+), lines \d+-\d+$`)
+	// markdownHeadingPattern matches a file heading of the Markdown format with its
+	// optional part label and mode
+	markdownHeadingPattern = regexp.MustCompile(`^## (.+?)(?: \(part (\d+) of (\d+), lines \d+-\d+\))?(?: \[([a-z-]+)\])?$`)
+	// fencePattern matches the opening line of a fenced code block
+	fencePattern = regexp.MustCompile("^(`{3,})[^`]*$")
+)
+
+// ParseBundles parses dir2prompt output in any of the built-in formats back into
+// files. The bundles are the chunks of one output, or independent outputs; parts of
+// files split over several chunks are joined in order.
+func ParseBundles(bundles ...[]byte) ([]BundleFile, error) {
+	var entries []Entry
+	for i, data := range bundles {
+		parsed, err := parseBundle(string(data))
+		if err != nil {
+			if len(bundles) > 1 {
+				return nil, fmt.Errorf("bundle %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		entries = append(entries, parsed...)
+	}
+	return joinParts(entries), nil
+}
+
+// parseBundle detects the format of a single bundle and parses its file entries
+func parseBundle(data string) ([]Entry, error) {
+	trimmed := strings.TrimLeft(data, " \t\n")
+
+	switch {
+	case strings.HasPrefix(trimmed, "<documents"):
+		return parseXMLBundle(trimmed)
+	case strings.HasPrefix(trimmed, "{\"type\":"):
+		return parseJSONLBundle(trimmed)
+	case strings.HasPrefix(trimmed, "{"):
+		return parseJSONBundle(trimmed)
+	case strings.HasPrefix(trimmed, "Boundary: "):
+		return parseBoundaryBundle(trimmed)
+	case strings.HasPrefix(trimmed, "## ") || strings.HasPrefix(trimmed, "# Chunk "):
+		return parseMarkdownBundle(trimmed), nil
+	}
+
+	entries := parseTextBundle(data)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no files found: the input is not dir2prompt output")
+	}
+	return entries, nil
+}
+
+// parseTextBundle parses the classic text format, where each file section ends with an
+// empty line before the next header
+func parseTextBundle(data string) []Entry {
+	var entries []Entry
+	headers := textHeaderPattern.FindAllStringSubmatchIndex(data, -1)
+	for i, h := range headers {
+		end := len(data)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		if data[h[2]:h[3]] != "File" {
+			continue
+		}
+
+		content := data[h[1]:end]
+		if strings.HasSuffix(content, "\n\n") {
+			content = content[:len(content)-2]
+		} else {
+			content = strings.TrimSuffix(content, "\n")
+		}
+
+		e := Entry{Path: data[h[4]:h[5]], Content: content}
+		if h[6] >= 0 {
+			e.Part, _ = strconv.Atoi(data[h[6]:h[7]])
+			e.Parts, _ = strconv.Atoi(data[h[8]:h[9]])
+		}
+		e.Mode = contentMode(content)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// parseBoundaryBundle parses the text format with a boundary declared on the first line
+func parseBoundaryBundle(data string) ([]Entry, error) {
+	declaration, rest, _ := strings.Cut(data, "\n")
+	boundary := strings.TrimSpace(strings.TrimPrefix(declaration, "Boundary: "))
+	if boundary == "" {
+		return nil, fmt.Errorf("empty boundary declaration")
+	}
+	delimiter := "--" + boundary
+
+	// Skip the preamble with the chunk header and directory structure
+	start := strings.Index(rest, "\n"+delimiter+"\n")
+	if strings.HasPrefix(rest, delimiter+"\n") {
+		start = -1
+	} else if start < 0 {
+		return nil, nil
+	}
+	rest = rest[start+1:]
+
+	var entries []Entry
+	for strings.HasPrefix(rest, delimiter+"\n") {
+		rest = rest[len(delimiter)+1:]
+
+		// The newline before the next boundary line belongs to the boundary
+		section := rest
+		next := strings.Index(rest, "\n"+delimiter)
+		if next >= 0 {
+			section, rest = rest[:next], rest[next+1:]
+		} else {
+			rest = ""
+		}
+
+		header, content, found := strings.Cut(section, "\n\n")
+		if !found {
+			header, content = strings.TrimSuffix(section, "\n"), ""
+		}
+
+		var e Entry
+		isFile := false
+		for _, line := range strings.Split(header, "\n") {
+			if p, ok := strings.CutPrefix(line, "File: "); ok {
+				e.Path, isFile = p, true
+			} else if m := partPattern.FindStringSubmatch(line); m != nil {
+				e.Part, _ = strconv.Atoi(m[1])
+				e.Parts, _ = strconv.Atoi(m[2])
+			}
+		}
+		if !isFile {
+			continue
+		}
+		e.Content = content
+		e.Mode = contentMode(content)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// contentMode recognizes the placeholders the token budget writes for reduced files
+// in formats that do not record the mode
+func contentMode(content string) string {
+	switch {
+	case strings.HasPrefix(content, "[Content omitted to fit the token budget: "):
+		return entryPathOnly
+	case strings.HasPrefix(content, "[Outline only, "):
+		return entryOutline
+	default:
+		return entryFull
+	}
+}
+
+// parseXMLBundle parses the XML format
+func parseXMLBundle(data string) ([]Entry, error) {
+	var doc struct {
+		Documents []struct {
+			Mode    string `xml:"mode,attr"`
+			Part    int    `xml:"part,attr"`
+			Parts   int    `xml:"parts,attr"`
+			Source  string `xml:"source"`
+			Content struct {
+				Encoding string `xml:"encoding,attr"`
+				Text     string `xml:",chardata"`
+			} `xml:"document_content"`
+		} `xml:"document"`
+	}
+	if err := xml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	}
+
+	var entries []Entry
+	for _, d := range doc.Documents {
+		content := d.Content.Text
+		if d.Content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode content of %s: %w", d.Source, err)
+			}
+			content = string(decoded)
+		}
+		entries = append(entries, Entry{Path: d.Source, Content: content, Mode: d.Mode, Part: d.Part, Parts: d.Parts})
+	}
+	return entries, nil
+}
+
+// parseJSONBundle parses the JSON format
+func parseJSONBundle(data string) ([]Entry, error) {
+	var doc struct {
+		Files []jsonFile `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	var entries []Entry
+	for _, f := range doc.Files {
+		entries = append(entries, f.entry())
+	}
+	return entries, nil
+}
+
+// parseJSONLBundle parses the JSONL format, ignoring records other than files
+func parseJSONLBundle(data string) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var record struct {
+			Type string `json:"type"`
+			jsonFile
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON on line %d: %w", line, err)
+		}
+		if record.Type == "file" {
+			entries = append(entries, record.entry())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSONL: %w", err)
+	}
+	return entries, nil
+}
+
+// entry converts a JSON file back into an entry
+func (f jsonFile) entry() Entry {
+	return Entry{Path: f.Path, Content: f.Content, Mode: f.Mode, Part: f.Part, Parts: f.Parts}
+}
+
+// parseMarkdownBundle parses the Markdown format. Code fences always end with a
+// newline; a marker after the fence tells that the file had none.
+func parseMarkdownBundle(data string) []Entry {
+	var entries []Entry
+	lines := strings.Split(data, "\n")
+	for i := 0; i+2 < len(lines); i++ {
+		m := markdownHeadingPattern.FindStringSubmatch(lines[i])
+		if m == nil || lines[i+1] != "" {
+			continue
+		}
+		fence := fencePattern.FindStringSubmatch(lines[i+2])
+		if fence == nil {
+			continue
+		}
+
+		// Collect the block up to the closing fence
+		var content strings.Builder
+		j := i + 3
+		for ; j < len(lines) && lines[j] != fence[1]; j++ {
+			content.WriteString(lines[j] + "\n")
+		}
+
+		heading := m[1]
+		if heading != "Directory Structure" && !strings.HasPrefix(heading, "Git Diff: ") {
+			e := Entry{Path: heading, Content: content.String(), Mode: m[4]}
+			if j+2 < len(lines) && lines[j+1] == "" && lines[j+2] == noFinalNewline {
+				e.Content = strings.TrimSuffix(e.Content, "\n")
+			}
+			e.Part, _ = strconv.Atoi(m[2])
+			e.Parts, _ = strconv.Atoi(m[3])
+			entries = append(entries, e)
+		}
+		i = j
+	}
+	return entries
+}
+
+// joinParts joins the parts of split files in order and marks files that cannot be
+// restored. Files keep the position of their first entry.
+func joinParts(entries []Entry) []BundleFile {
+	var files []BundleFile
+	parts := make(map[string][]Entry)
+	index := make(map[string]int)
+	for _, e := range entries {
+		if _, ok := index[e.Path]; !ok || e.Part == 0 {
+			index[e.Path] = len(files)
+			files = append(files, BundleFile{Path: e.Path})
+		}
+		if e.Part > 0 {
+			parts[e.Path] = append(parts[e.Path], e)
+			continue
+		}
+
+		delete(parts, e.Path)
+		f := &files[index[e.Path]]
+		f.Content = e.Content
+		if e.Mode != "" && e.Mode != entryFull {
+			f.Skipped = fmt.Sprintf("the bundle only contains its %s", strings.ReplaceAll(e.Mode, "-", " "))
+		}
+	}
+
+	for relPath, list := range parts {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Part < list[j].Part })
+		f := &files[index[relPath]]
+
+		var content strings.Builder
+		for i, e := range list {
+			if e.Part != i+1 || e.Parts != list[0].Parts {
+				f.Skipped = fmt.Sprintf("part %d of %d is missing or duplicated", i+1, list[0].Parts)
+				break
+			}
+			content.WriteString(e.Content)
+		}
+		if f.Skipped == "" && len(list) != list[0].Parts {
+			f.Skipped = fmt.Sprintf("only %d of %d parts are present", len(list), list[0].Parts)
+		}
+		f.Content = content.String()
+	}
+
+	// Drop duplicates replaced by a later complete copy of the file
+	result := files[:0]
+	for i, f := range files {
+		if index[f.Path] == i {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Unpack writes the restored files below dir, creating directories as needed. Files
+// that cannot be restored are skipped with a message. With dryRun the files are only
+// listed. Paths that are absolute or escape dir, also through symbolic links, are
+// rejected before anything is written.
+func Unpack(files []BundleFile, dir string, dryRun bool, log io.Writer) error {
+	targets := make([]string, len(files))
+	for i, f := range files {
+		target, err := safeJoin(dir, f.Path)
+		if err != nil {
+			return err
+		}
+		targets[i] = target
+	}
+
+	// Symbolic links inside dir must not lead outside of it, which is checked before
+	// any directory is created through them
+	if _, err := os.Stat(dir); err == nil {
+		for _, target := range targets {
+			if err := checkTarget(dir, target); err != nil {
+				return err
+			}
+		}
+	}
+
+	written := 0
+	for i, f := range files {
+		if f.Skipped != "" {
+			fmt.Fprintf(log, "Skipping %s: %s\n", f.Path, f.Skipped)
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(log, "Would write %s (%d bytes)\n", targets[i], len(f.Content))
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(targets[i]), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(targets[i], []byte(f.Content), 0644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", f.Path, err)
+		}
+		fmt.Fprintf(log, "Wrote %s (%d bytes)\n", targets[i], len(f.Content))
+		written++
+	}
+
+	if !dryRun {
+		fmt.Fprintf(log, "Unpacked %d of %d files into %s\n", written, len(files), dir)
+	}
+	return nil
+}
+
+// safeJoin joins a slash-separated relative path from a bundle to root, rejecting
+// absolute paths and paths that escape root
+func safeJoin(root, relPath string) (string, error) {
+	slashed := strings.ReplaceAll(relPath, "\\", "/")
+	cleaned := path.Clean(slashed)
+	if relPath == "" || path.IsAbs(slashed) || filepath.IsAbs(relPath) || filepath.VolumeName(relPath) != "" {
+		return "", fmt.Errorf("refusing to write %q: path must be relative", relPath)
+	}
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("refusing to write %q: path escapes the target directory", relPath)
+	}
+	return filepath.Join(root, filepath.FromSlash(cleaned)), nil
+}
+
+// checkInside verifies that dir, with symbolic links resolved, is located inside root
+func checkInside(root, dir string) error {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to write to %s: it resolves outside %s", dir, root)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTripFiles are files whose content is hard to delimit in at least one format
+var roundTripFiles = map[string]string{
+	"main.go":             "package main\n\nfunc main() {}\n",
+	"docs/guide.md":       "# Guide\n\n````go\nfmt.Println(\"```\")\n````\n",
+	"src/no_newline.txt":  "last line without newline",
+	"src/cdata.xml":       "<a><![CDATA[x]]></a>\n",
+	"src/control.txt":     "page one\fpage two\x1b[0m\n",
+	"src/windows.txt":     "line one\r\nline two\r\n",
+	"src/trailing.txt":    "ends with blank lines\n\n\n",
+	"deep/a/b/c/notes.md": "---\ntitle: front matter\n---\n",
+}
+
+// priorOutput is a file that looks like dir2prompt output itself
+const priorOutput = "Directory Structure:\n\n---\nFile: main.go\n---\n\npackage main\n\n"
+
+// TestUnpackRoundTrip tests that parsing the output of Process restores every file
+func TestUnpackRoundTrip(t *testing.T) {
+	withPrior := map[string]string{"prior.txt": priorOutput}
+	for name, content := range roundTripFiles {
+		withPrior[name] = content
+	}
+
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		format   string
+		boundary string
+	}{
+		{"text", roundTripFiles, FormatText, BoundaryNone},
+		{"text with boundary", withPrior, FormatText, BoundaryAuto},
+		{"text with random boundary", roundTripFiles, FormatText, BoundaryRandom},
+		{"xml", withPrior, FormatXML, ""},
+		{"json", withPrior, FormatJSON, ""},
+		{"jsonl", withPrior, FormatJSONL, ""},
+		{"markdown", withPrior, FormatMarkdown, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			output := filepath.Join(t.TempDir(), "bundle.txt")
+			runProcess(t, Config{
+				DirPath:      dir,
+				IncludeFiles: []string{"**"},
+				Output:       output,
+				Format:       tc.format,
+				Boundary:     tc.boundary,
+			})
+
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			files, err := ParseBundles(data)
+			if err != nil {
+				t.Fatalf("ParseBundles error: %v", err)
+			}
+
+			if len(files) != len(tc.files) {
+				t.Fatalf("Expected %d files, got %d", len(tc.files), len(files))
+			}
+			for _, f := range files {
+				expected, ok := tc.files[f.Path]
+				if !ok {
+					t.Errorf("Unexpected file %s", f.Path)
+					continue
+				}
+				if f.Skipped != "" || f.Content != expected {
+					t.Errorf("%s not restored: %q (skipped: %s), want %q", f.Path, f.Content, f.Skipped, expected)
+				}
+			}
+		})
+	}
+}
+
+// TestParseBundlesParts tests joining files split over several chunks
+func TestParseBundlesParts(t *testing.T) {
+	parts := []Entry{
+		{Path: "big.go", Content: "line 1\nline 2\n", Mode: entryFull, Part: 1, Parts: 2, FirstLine: 1, LastLine: 2},
+		{Path: "big.go", Content: "line 3\n", Mode: entryFull, Part: 2, Parts: 2, FirstLine: 3, LastLine: 3},
+	}
+
+	for _, format := range []string{FormatText, FormatXML, FormatMarkdown, FormatJSON, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			// Pass the chunks out of order
+			second := render(t, format, Document{Chunk: 2, Chunks: 2, Contents: []string{"big.go (part 2 of 2)"}}, parts[1:], nil)
+			first := render(t, format, Document{Chunk: 1, Chunks: 2, Contents: []string{"big.go (part 1 of 2)"}}, parts[:1], nil)
+
+			files, err := ParseBundles([]byte(second), []byte(first))
+			if err != nil {
+				t.Fatalf("ParseBundles error: %v", err)
+			}
+			if len(files) != 1 || files[0].Content != "line 1\nline 2\nline 3\n" || files[0].Skipped != "" {
+				t.Errorf("Unexpected files: %+v", files)
+			}
+
+			// A missing part makes the file incomplete
+			files, err = ParseBundles([]byte(first))
+			if err != nil {
+				t.Fatalf("ParseBundles error: %v", err)
+			}
+			if len(files) != 1 || files[0].Skipped == "" {
+				t.Errorf("Expected incomplete file to be skipped: %+v", files)
+			}
+		})
+	}
+}
+
+// TestParseBundlesReducedFiles tests that files reduced by the token budget are not restored
+func TestParseBundlesReducedFiles(t *testing.T) {
+	entries := []Entry{
+		{Path: "kept.go", Content: "package kept\n", Mode: entryFull},
+		{Path: "omitted.go", Content: "[Content omitted to fit the token budget: 120 tokens]\n", Mode: entryPathOnly},
+		{Path: "outlined.go", Content: "[Outline only, 1 of 40 lines shown to fit the token budget]\nfunc A()\n", Mode: entryOutline},
+	}
+
+	for _, format := range []string{FormatText, FormatXML, FormatMarkdown, FormatJSON} {
+		files, err := ParseBundles([]byte(render(t, format, Document{Tree: "tree\n"}, entries, nil)))
+		if err != nil {
+			t.Fatalf("%s: ParseBundles error: %v", format, err)
+		}
+		if len(files) != 3 || files[0].Skipped != "" || files[1].Skipped == "" || files[2].Skipped == "" {
+			t.Errorf("%s: unexpected files: %+v", format, files)
+		}
+	}
+}
+
+// TestParseBundlesInvalid tests that input which is not dir2prompt output is rejected
+func TestParseBundlesInvalid(t *testing.T) {
+	for _, input := range []string{"just some text\n", "<documents><document>", "{\"files\": [}"} {
+		if _, err := ParseBundles([]byte(input)); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+// TestSafeJoin tests path-traversal protection
+func TestSafeJoin(t *testing.T) {
+	testCases := []struct {
+		path  string
+		valid bool
+	}{
+		{"main.go", true},
+		{"src/./lib.go", true},
+		{"src/../main.go", true},
+		{"../main.go", false},
+		{"src/../../main.go", false},
+		{"..\\main.go", false},
+		{"/etc/passwd", false},
+		{"..", false},
+		{".", false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		target, err := safeJoin("/out", tc.path)
+		if (err == nil) != tc.valid {
+			t.Errorf("safeJoin(%q) = %q, %v; want valid: %v", tc.path, target, err, tc.valid)
+		}
+		if err == nil && !strings.HasPrefix(target, filepath.Clean("/out")+string(filepath.Separator)) {
+			t.Errorf("safeJoin(%q) = %q escapes the root", tc.path, target)
+		}
+	}
+}
+
+// TestUnpack tests writing restored files, dry runs and rejected paths
+func TestUnpack(t *testing.T) {
+	files := []BundleFile{
+		{Path: "main.go", Content: "package main\n"},
+		{Path: "src/lib.go", Content: "package src\n"},
+		{Path: "omitted.go", Skipped: "the bundle only contains its path only"},
+	}
+
+	// Dry run writes nothing
+	dir := filepath.Join(t.TempDir(), "out")
+	var log strings.Builder
+	if err := Unpack(files, dir, true, &log); err != nil {
+		t.Fatalf("Unpack dry run error: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Dry run created %s", dir)
+	}
+	if !strings.Contains(log.String(), "Would write "+filepath.Join(dir, "src", "lib.go")) {
+		t.Errorf("Unexpected dry run log:\n%s", log.String())
+	}
+
+	log.Reset()
+	if err := Unpack(files, dir, false, &log); err != nil {
+		t.Fatalf("Unpack error: %v", err)
+	}
+	for _, f := range files[:2] {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil || string(content) != f.Content {
+			t.Errorf("%s = %q, %v", f.Path, content, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "omitted.go")); !os.IsNotExist(err) {
+		t.Error("Skipped file was written")
+	}
+	if !strings.Contains(log.String(), "Skipping omitted.go") || !strings.Contains(log.String(), "Unpacked 2 of 3 files") {
+		t.Errorf("Unexpected log:\n%s", log.String())
+	}
+
+	// A single unsafe path rejects the whole bundle before anything is written
+	unsafeDir := filepath.Join(t.TempDir(), "unsafe")
+	err := Unpack([]BundleFile{{Path: "ok.go"}, {Path: "../escape.go"}}, unsafeDir, false, &log)
+	if err == nil {
+		t.Error("Expected error for path escaping the target directory")
+	}
+	if _, err := os.Stat(unsafeDir); !os.IsNotExist(err) {
+		t.Error("Files were written despite an unsafe path")
+	}
+
+	// Symbolic links inside the target directory cannot redirect writes
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	if err := Unpack([]BundleFile{{Path: "link/escape.go", Content: "x"}}, dir, false, &log); err == nil {
+		t.Error("Expected error for a path through a symbolic link leaving the target directory")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "escape.go")); !os.IsNotExist(err) {
+		t.Error("File was written outside the target directory")
+	}
+
+	// Nor create directories through them, and the bundle is rejected as a whole
+	err = Unpack([]BundleFile{{Path: "first.go", Content: "x"}, {Path: "link/sub/escape.go", Content: "x"}}, dir, false, &log)
+	if err == nil {
+		t.Error("Expected error for a new directory below a symbolic link leaving the target directory")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "sub")); !os.IsNotExist(err) {
+		t.Error("Directory was created outside the target directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "first.go")); !os.IsNotExist(err) {
+		t.Error("Files were written despite a path through a symbolic link")
+	}
+}
@@ -0,0 +1,229 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long watch mode waits for a burst of changes to end
+const DefaultWatchDebounce = 300 * time.Millisecond
+
+// atomicFile is an output written to a temporary file next to its destination and
+// renamed over it once complete, so readers never see a partial output
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+// createAtomic creates a temporary file for the output at path. The file name starts
+// with a dot so scans and watchers ignore it.
+func createAtomic(path string) (*atomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return &atomicFile{File: file, path: path}, nil
+}
+
+// commit replaces the output with the completed file
+func (f *atomicFile) commit() error {
+	if err := f.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// discard removes the temporary file unless it was committed
+func (f *atomicFile) discard() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// Watch writes the output and writes it again whenever a file that can affect it
+// changes, appears or disappears, until ctx is done. Changes arriving within debounce
+// of each other are handled by a single run. The output file is replaced atomically
+// and left out of the scan.
+func (p *Processor) Watch(ctx context.Context, debounce time.Duration) error {
+	switch {
+	case p.config.Output == "" || p.config.Output == "-":
+		return fmt.Errorf("watch mode requires an output file")
+	case p.config.ChunkTokens > 0:
+		return fmt.Errorf("watch mode cannot be combined with chunked output")
+	case p.config.Rev != "":
+		return fmt.Errorf("watch mode reads the working tree and cannot be combined with a revision")
+	}
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	dir, err := filepath.Abs(p.config.DirPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	output, err := filepath.Abs(p.config.Output)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output file: %w", err)
+	}
+	p.config.DirPath = dir
+	p.atomicOutput = true
+	if rel, err := filepath.Rel(dir, output); err == nil && !strings.HasPrefix(rel, "..") {
+		p.outputPath = filepath.ToSlash(rel)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// The first run loads the ignore files that decide which directories are watched
+	if err := p.Process(); err != nil {
+		return err
+	}
+	if err := p.watchTree(watcher, dir); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Watching %s for changes, writing %s (press Ctrl+C to stop)\n", dir, p.config.Output)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	var changed []string
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			relPath, relevant := p.watchEvent(watcher, dir, event)
+			if !relevant {
+				continue
+			}
+			changed = append(changed, relPath)
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Warning: watcher error: %v\n", err)
+
+		case <-timer.C:
+			// A failed run, e.g. a file removed while it was read, is retried on the next change
+			if err := p.Process(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Updated %s after changes to %s\n", p.config.Output, describeChanges(changed))
+			}
+			changed = nil
+		}
+	}
+}
+
+// watchTree watches a directory and every directory below it that a scan would enter
+func (p *Processor) watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Directories may disappear while they are added
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(p.config.DirPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		if relPath != "." && (strings.HasPrefix(entry.Name(), ".") || p.isGitignored(relPath, true) || p.promptIgnore.Match(relPath, true)) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", relPath, err)
+		}
+		return nil
+	})
+}
+
+// watchEvent returns the relative path of an event and whether it can change the
+// output, watching directories that were created
+func (p *Processor) watchEvent(watcher *fsnotify.Watcher, dir string, event fsnotify.Event) (string, bool) {
+	if !event.Has(fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename) {
+		return "", false
+	}
+	relPath, err := filepath.Rel(dir, event.Name)
+	if err != nil {
+		return "", false
+	}
+	slashPath := filepath.ToSlash(relPath)
+	if slashPath == p.outputPath {
+		return "", false
+	}
+
+	// Ignore files change what is selected
+	name := filepath.Base(relPath)
+	switch name {
+	case ".gitignore", promptIgnoreFile, promptIncludeFile:
+		return slashPath, true
+	}
+	for _, part := range strings.Split(slashPath, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+
+	if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+		if p.isGitignored(relPath, true) {
+			return "", false
+		}
+		if event.Has(fsnotify.Create) {
+			if err := p.watchTree(watcher, event.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		return slashPath, true
+	}
+
+	// Removed or renamed paths may have been directories holding included files
+	if event.Has(fsnotify.Remove | fsnotify.Rename) {
+		return slashPath, true
+	}
+	if p.isGitignored(relPath, false) {
+		return "", false
+	}
+	return slashPath, p.config.TreeScope == TreeScopeAll || p.shouldIncludeFile(relPath)
+}
+
+// describeChanges lists the first changed paths
+func describeChanges(changed []string) string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, relPath := range changed {
+		if !seen[relPath] {
+			seen[relPath] = true
+			unique = append(unique, relPath)
+		}
+	}
+	if len(unique) == 1 {
+		return unique[0]
+	}
+	return fmt.Sprintf("%s and %d more", unique[0], len(unique)-1)
+}
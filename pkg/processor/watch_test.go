@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForOutput polls the output file until check accepts its content
+func waitForOutput(t *testing.T, output string, check func(string) bool) string {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		content, err := os.ReadFile(output)
+		if err == nil && check(string(content)) {
+			return string(content)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the output, last content:\n%s", content)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestWatch tests that the output follows changed, new and removed files and never
+// includes itself
+func TestWatch(t *testing.T) {
+	tempDir := setupReportDir(t)
+	output := filepath.Join(tempDir, "context.txt")
+
+	p, err := NewProcessor(Config{DirPath: tempDir, IncludeFiles: []string{"**/*.go"}, Output: output})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.Watch(ctx, 20*time.Millisecond)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch error: %v", err)
+		}
+	}()
+
+	waitForOutput(t, output, func(content string) bool {
+		return strings.Contains(content, "File: main.go")
+	})
+	// Give the watcher time to add the directories after the first run
+	time.Sleep(200 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(tempDir, "main.go"), []byte("package main\n\n// changed\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	waitForOutput(t, output, func(content string) bool {
+		return strings.Contains(content, "// changed")
+	})
+
+	// New directories are watched, so files created inside them are picked up
+	if err := os.MkdirAll(filepath.Join(tempDir, "pkg", "c"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(tempDir, "pkg", "c", "new.go"), []byte("package c\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	waitForOutput(t, output, func(content string) bool {
+		return strings.Contains(content, "File: pkg/c/new.go")
+	})
+
+	if err := os.Remove(filepath.Join(tempDir, "pkg", "b", "small.go")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	content := waitForOutput(t, output, func(content string) bool {
+		return !strings.Contains(content, "small.go")
+	})
+	if strings.Contains(content, "context.txt") {
+		t.Errorf("Expected the output to leave itself out:\n%s", content)
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("Temporary output file %s was left behind", entry.Name())
+		}
+	}
+}
+
+// TestWatchRequiresOutputFile tests the outputs watch mode cannot keep up to date
+func TestWatchRequiresOutputFile(t *testing.T) {
+	tempDir := setupReportDir(t)
+	output := filepath.Join(t.TempDir(), "context.txt")
+
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"stdout", Config{DirPath: tempDir, Output: "-"}},
+		{"chunks", Config{DirPath: tempDir, Output: output, ChunkTokens: 1000}},
+		{"revision", Config{DirPath: tempDir, Output: output, Rev: "HEAD"}},
+	}
+
+	for _, test := range tests {
+		p, err := NewProcessor(test.config)
+		if err != nil {
+			t.Fatalf("%s: failed to create processor: %v", test.name, err)
+		}
+		if err := p.Watch(context.Background(), 0); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}